@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// parses lines of alias = canonical into a map from each alias to its canonical
+// tag. blank lines and # comments are skipped.
+func ParseAliases(content string) (map[string]string, error) {
+	aliases := map[string]string{}
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		alias, canonical, ok := strings.Cut(line, "=")
+		alias, canonical = strings.TrimSpace(alias), strings.TrimSpace(canonical)
+		if !ok || alias == "" || canonical == "" {
+			return nil, fmt.Errorf("line %d: expected alias = canonical, got %q", i+1, line)
+		}
+		aliases[alias] = canonical
+	}
+	return aliases, nil
+}
+
+// reads a file of aliases, as ParseAliases.
+func ReadAliases(path string) (map[string]string, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := ParseAliases(string(dat))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return aliases, nil
+}
+
+// the tags with each alias replaced by its canonical tag, in a new slice.
+func Canonical(tags []string, aliases map[string]string) []string {
+	canonical := []string{}
+	for _, tag := range tags {
+		if c, ok := aliases[tag]; ok {
+			tag = c
+		}
+		canonical = append(canonical, tag)
+	}
+	return canonical
+}
+
+// the query with its aliased tags replaced by their canonical tags.
+func AliasQuery(queries Query, aliases map[string]string) Query {
+	aliased := Query{tags: Canonical(queries.tags, aliases)}
+	for i := range queries.groups {
+		aliased.groups = append(aliased.groups, Canonical(queries.groups[i], aliases))
+		aliased.negated = append(aliased.negated, Canonical(queries.negated[i], aliases))
+	}
+	return aliased
+}
+
+// the entries with their aliased tags replaced by their canonical tags, so that
+// files tagged ml and machine-learning are found together.
+func AliasEntries(entries []Entry, aliases map[string]string) []Entry {
+	aliased := []Entry{}
+	for _, e := range entries {
+		// an alias listed alongside its canonical tag is the same tag twice:
+		e.tags, _ = UniqueTags(Canonical(e.tags, aliases))
+		aliased = append(aliased, e)
+	}
+	return aliased
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadAliases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aliases")
+	assert.NoError(t, os.WriteFile(path, []byte("# comment\nf = foo\nscience=sot\n"), 0644))
+	aliases, err := ReadAliases(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"f": "foo", "science": "sot"}, aliases)
+
+	queries := AliasQuery(ParseQuery("f+-science,bar!science"), aliases)
+	assert.Equal(t, []string{"foo", "bar"}, queries.tags)
+	assert.Equal(t, [][]string{{"foo"}, {"bar"}}, queries.groups)
+	assert.Equal(t, [][]string{{"sot", "sot"}, {"sot"}}, queries.negated)
+
+	entries := mockEntries(t, "./mock/*.md")
+	files := ProcessQueries(entries, Tagmap(entries), AliasQuery(ParseQuery("f"), aliases))
+	assert.Equal(t, []string{"01.foo.md"}, files.Members())
+}
+
+func TestParseAliasesMalformed(t *testing.T) {
+	_, err := ParseAliases("f = foo\nscience\n")
+	assert.ErrorContains(t, err, "line 2")
+	_, err = ParseAliases("= foo\n")
+	assert.ErrorContains(t, err, "line 1")
+}
+
+func TestAliasEntries(t *testing.T) {
+	entries := []Entry{{filename: "a.md", tags: []string{"f", "bar"}}}
+	aliased := AliasEntries(entries, map[string]string{"f": "foo"})
+	assert.Equal(t, []string{"foo", "bar"}, aliased[0].tags)
+	// the originals are untouched:
+	assert.Equal(t, []string{"f", "bar"}, entries[0].tags)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// a labeled set of files, such as a separate vault, read alongside others.
+type Collection struct {
+	name string
+	glob string
+}
+
+// parses a collection given as NAME=GLOB.
+func ParseCollection(spec string) (Collection, error) {
+	name, glob, ok := strings.Cut(spec, "=")
+	if !ok || name == "" || glob == "" {
+		return Collection{}, fmt.Errorf("collection %q should be NAME=GLOB", spec)
+	}
+	return Collection{name, glob}, nil
+}
+
+// the files of every collection, less those matching any of the excludes, as
+// ReadCollections reads them.
+func CollectionFiles(collections []Collection, excludes []string) (files []string, err error) {
+	for _, c := range collections {
+		matched, err := CollectionFilelist(c, excludes)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matched...)
+	}
+	return files, nil
+}
+
+// the files of the collection, less those matching any of the excludes.
+func CollectionFilelist(c Collection, excludes []string) ([]string, error) {
+	files, err := Filelist(c.glob)
+	if err != nil {
+		return nil, err
+	}
+	return Exclude(files, excludes)
+}
+
+// reads the files of each collection into entries labeled with its name. the
+// label also prefixes each filename, as in work:01.foo.md, so that results say
+// where they came from and files of the same name in two collections stay apart.
+// files matching any of the excludes are left out, as from a glob.
+func ReadCollections(collections []Collection, excludes []string, opts ReadOptions) (entries []Entry, err error) {
+	for _, c := range collections {
+		files, err := CollectionFilelist(c, excludes)
+		if err != nil {
+			return nil, err
+		}
+		opts.root = GlobRoot(c.glob)
+		read, err := ReadEntries(files, opts)
+		if err != nil {
+			return nil, err
+		}
+		if len(read) == 0 {
+			Warnf("no files match the glob %q of collection %q", c.glob, c.name)
+		}
+		for _, e := range read {
+			e.collection = c.name
+			e.filename = c.name + ":" + e.filename
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCollection(t *testing.T) {
+	c, err := ParseCollection("work=./notes/*.md")
+	assert.NoError(t, err)
+	assert.Equal(t, Collection{"work", "./notes/*.md"}, c)
+
+	for _, spec := range []string{"work", "=./notes/*.md", "work="} {
+		_, err := ParseCollection(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestReadCollections(t *testing.T) {
+	work, personal := t.TempDir(), t.TempDir()
+	// the same filename in both collections:
+	os.WriteFile(filepath.Join(work, "01.md"), []byte("# 01.md\n: 2024.09.25\n+ sot\n"), 0644)
+	os.WriteFile(filepath.Join(work, "02.md"), []byte("# 02.md\n: 2024.09.25\n+ foo\n"), 0644)
+	os.WriteFile(filepath.Join(personal, "01.md"), []byte("# 01.md\n: 2024.09.25\n+ sot\n"), 0644)
+
+	collections := []Collection{
+		{"work", filepath.Join(work, "*.md")},
+		{"personal", filepath.Join(personal, "*.md")},
+	}
+	entries, err := ReadCollections(collections, nil, ReadOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "work", entries[0].collection)
+
+	queries := ParseQuery("sot")
+	collection := Collect(entries, Tagmap(entries), queries)
+	var buf bytes.Buffer
+	Print(&buf, entries, collection, queries, PrintOptions{pipe: true})
+	assert.Equal(t, "personal:01.md\nwork:01.md\n\n", buf.String())
+}
+
+func TestCollectionFiles(t *testing.T) {
+	collections := []Collection{
+		{"clusters", "mock/clusters/0[12]*.md"},
+		{"mock", "mock/0[56]*.md"},
+	}
+	files, err := CollectionFiles(collections, nil)
+	assert.NoError(t, err)
+	expected := []string{
+		"mock/clusters/01.baking.md",
+		"mock/clusters/02.starter.md",
+		"mock/05.quz.md",
+		"mock/06.quz.md",
+	}
+	assert.Equal(t, expected, files)
+
+	_, err = CollectionFiles([]Collection{{"bad", "mock/[*.md"}}, nil)
+	assert.Error(t, err)
+
+	// the excludes apply to every collection:
+	files, err = CollectionFiles(collections, []string{"mock/clusters/02*.md", "./mock/06*.md"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mock/clusters/01.baking.md", "mock/05.quz.md"}, files)
+}
+
+func TestReadCollectionsExclude(t *testing.T) {
+	collections := []Collection{{"clusters", "mock/clusters/*.md"}}
+	entries, err := ReadCollections(collections, []string{"mock/clusters/0[234]*.md"}, ReadOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "clusters:01.baking.md", entries[0].filename)
+}
+
+func TestCollectionEarlyModes(t *testing.T) {
+	args := []string{"--collection", "c=mock/clusters/*.md", "--exclude-glob", "mock/clusters/0[34]*.md"}
+
+	// the early modes read the collection, not the glob:
+	out, _ := runMain(t, append(args, "--list-files")...)
+	assert.Equal(t, "mock/clusters/01.baking.md\nmock/clusters/02.starter.md\n", out)
+	out, _ = runMain(t, append(args, "--top-tags", "1")...)
+	assert.Contains(t, out, "bread")
+	assert.NotContains(t, out, "physics")
+
+	out, _ = runMain(t, append(args, "--pipe", "bread")...)
+	assert.Equal(t, "c:01.baking.md\nc:02.starter.md\n\n", out)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// the ways --color may be set.
+var COLORS = []string{"auto", "always", "never"}
+
+// the ANSI codes wrapped around each tag name.
+const (
+	TAG_COLOR   = "\x1b[36m"
+	RESET_COLOR = "\x1b[0m"
+)
+
+// checks whether stdout is a terminal rather than a pipe or a file. a variable,
+// so that tests can pretend it is.
+var isStdoutTerminal = func() bool {
+	stat, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// whether to color output with the given --color, where auto colors only a
+// terminal.
+func UseColor(mode string, terminal bool) bool {
+	return mode == "always" || (mode == "auto" && terminal)
+}
+
+// colors the key of each line of a section: the whole line, or what comes
+// before its = when it has a count. headers and blank lines are left alone, and
+// so is the padding, which keeps counts lined up.
+func ColorKeys(section string) string {
+	lines := strings.Split(section, "\n")
+	for i, line := range lines {
+		if line == "" || strings.HasPrefix(line, "[") {
+			continue
+		}
+		key, count, found := strings.Cut(line, " =")
+		name := strings.TrimRight(key, " ")
+		lines[i] = TAG_COLOR + name + RESET_COLOR + key[len(name):]
+		if found {
+			lines[i] += " =" + count
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUseColor(t *testing.T) {
+	assert.True(t, UseColor("always", false))
+	assert.False(t, UseColor("never", true))
+	assert.True(t, UseColor("auto", true))
+	assert.False(t, UseColor("auto", false))
+	// tests never print to a terminal:
+	assert.False(t, UseColor("auto", isStdoutTerminal()))
+}
+
+func TestColorKeys(t *testing.T) {
+	section := "[adjacencies]\nfoo     = 2\nscience = 1\n"
+	expected := "[adjacencies]\n" +
+		TAG_COLOR + "foo" + RESET_COLOR + "     = 2\n" +
+		TAG_COLOR + "science" + RESET_COLOR + " = 1\n"
+	assert.Equal(t, expected, ColorKeys(section))
+	assert.Equal(t, "[tags]\n"+TAG_COLOR+"sot"+RESET_COLOR+"\n", ColorKeys("[tags]\nsot\n"))
+}
+
+func TestPrintColor(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("science")
+	collection := Collect(entries, Tagmap(entries), queries)
+
+	var buf bytes.Buffer
+	Print(&buf, entries, collection, queries, PrintOptions{color: true})
+	colored := TAG_COLOR + "sot" + RESET_COLOR
+	assert.Contains(t, buf.String(), "[tags]\n"+TAG_COLOR+"science"+RESET_COLOR+"\n")
+	assert.Contains(t, buf.String(), "[adjacencies]\n"+colored+"\n")
+	// but never the files or sums:
+	assert.Contains(t, buf.String(), "[files]\n02.foo.md\n")
+	assert.Contains(t, buf.String(), "[sums]\nfiles       = 3\n")
+}
+
+func TestColorOutputFile(t *testing.T) {
+	// as if run from a terminal:
+	old := isStdoutTerminal
+	isStdoutTerminal = func() bool { return true }
+	defer func() { isStdoutTerminal = old }()
+
+	out, _ := runMain(t, "--glob", TEST_PATTERN, "science")
+	assert.Contains(t, out, TAG_COLOR)
+
+	// but a file is never colored unless asked:
+	path := filepath.Join(t.TempDir(), "out.txt")
+	runMain(t, "--glob", TEST_PATTERN, "--output", path, "science")
+	written, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(written), "[tags]\nscience\n")
+	assert.NotContains(t, string(written), TAG_COLOR)
+
+	runMain(t, "--glob", TEST_PATTERN, "--output", path, "--color", "always", "science")
+	written, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(written), TAG_COLOR)
+}
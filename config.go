@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// the name of the config file, looked for in the working directory and then in
+// the home directory.
+const CONFIG_NAME = ".gagrc"
+
+// parses the flat subset of TOML a config needs: lines of key = value, where the
+// key names a flag and the value is a quoted string, a bare boolean or number, or
+// an array of them for a flag which may be repeated. blank lines and # comments
+// are skipped.
+func ParseConfig(content string) (map[string][]string, error) {
+	config := map[string][]string{}
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: expected key = value, got %q", i+1, line)
+		}
+		if _, ok := config[key]; ok {
+			return nil, fmt.Errorf("line %d: %s is set twice", i+1, key)
+		}
+		values, err := ParseConfigValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		config[key] = values
+	}
+	return config, nil
+}
+
+// parses a single value, or each value of an array.
+func ParseConfigValue(value string) ([]string, error) {
+	if inner, ok := strings.CutPrefix(value, "["); ok {
+		inner, ok = strings.CutSuffix(inner, "]")
+		if !ok {
+			return nil, fmt.Errorf("unclosed array %q", value)
+		}
+		values := []string{}
+		for _, v := range strings.Split(inner, ",") {
+			// allowing a trailing comma:
+			if v = strings.TrimSpace(v); v == "" {
+				continue
+			}
+			s, err := ParseConfigScalar(v)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	}
+	s, err := ParseConfigScalar(value)
+	if err != nil {
+		return nil, err
+	}
+	return []string{s}, nil
+}
+
+// parses a quoted string, a literal string in single quotes, a boolean or a
+// number, as the string a flag would be set with.
+func ParseConfigScalar(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		return strconv.Unquote(value)
+	case len(value) > 1 && strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'"):
+		return value[1 : len(value)-1], nil
+	case value == "true" || value == "false":
+		return value, nil
+	}
+	if _, err := strconv.ParseFloat(value, 64); err != nil {
+		return "", fmt.Errorf("expected a quoted string, boolean or number, got %q", value)
+	}
+	return value, nil
+}
+
+// finds the home directory searched for a config file, replaced in tests.
+var home = os.UserHomeDir
+
+// the path of the config file, if there is one.
+func FindConfig() (string, bool) {
+	dirs := []string{"."}
+	if dir, err := home(); err == nil {
+		dirs = append(dirs, dir)
+	}
+	for _, dir := range dirs {
+		path := filepath.Join(dir, CONFIG_NAME)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// reads a config file, as ParseConfig.
+func ReadConfig(path string) (map[string][]string, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := ParseConfig(string(dat))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+// sets each flag named in the config, unless it was already given on the command
+// line, which always wins.
+func ApplyConfig(flags *flag.FlagSet, config map[string][]string) error {
+	given := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	keys := []string{}
+	for key := range config {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if flags.Lookup(key) == nil {
+			return fmt.Errorf("unknown flag %q in config", key)
+		}
+		if given[key] {
+			continue
+		}
+		for _, value := range config[key] {
+			if err := flags.Set(key, value); err != nil {
+				return fmt.Errorf("bad value for %s in config: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
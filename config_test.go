@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig("# defaults\nglob = [\"notes/*.md\", 'drafts/*.md',]\npipe = true\nrecent = 10\nsort = \"date\"\n")
+	assert.NoError(t, err)
+	expected := map[string][]string{
+		"glob":   {"notes/*.md", "drafts/*.md"},
+		"pipe":   {"true"},
+		"recent": {"10"},
+		"sort":   {"date"},
+	}
+	assert.Equal(t, expected, config)
+}
+
+func TestParseConfigMalformed(t *testing.T) {
+	_, err := ParseConfig("pipe = true\nsort = date\n")
+	assert.ErrorContains(t, err, "line 2")
+	_, err = ParseConfig("[section]\n")
+	assert.ErrorContains(t, err, "line 1")
+	_, err = ParseConfig("glob = [\"a\"\n")
+	assert.ErrorContains(t, err, "unclosed")
+	_, err = ParseConfig("pipe = true\npipe = false\n")
+	assert.ErrorContains(t, err, "twice")
+}
+
+func TestApplyConfig(t *testing.T) {
+	flags := flag.NewFlagSet("gag", flag.ContinueOnError)
+	var globs listFlag
+	flags.Var(&globs, "glob", "")
+	pipe := flags.Bool("pipe", false, "")
+	sort := flags.String("sort", "name", "")
+	assert.NoError(t, flags.Parse([]string{"--sort", "date-desc"}))
+
+	config := map[string][]string{"glob": {"a/*.md", "b/*.md"}, "pipe": {"true"}, "sort": {"date"}}
+	assert.NoError(t, ApplyConfig(flags, config))
+	assert.Equal(t, listFlag{"a/*.md", "b/*.md"}, globs)
+	assert.True(t, *pipe)
+	// given on the command line:
+	assert.Equal(t, "date-desc", *sort)
+
+	assert.ErrorContains(t, ApplyConfig(flags, map[string][]string{"nope": {"1"}}), "unknown flag")
+	fresh := flag.NewFlagSet("gag", flag.ContinueOnError)
+	fresh.Bool("pipe", false, "")
+	assert.ErrorContains(t, ApplyConfig(fresh, map[string][]string{"pipe": {"maybe"}}), "pipe")
+}
+
+func TestConfigGlob(t *testing.T) {
+	mock, err := filepath.Abs("mock")
+	assert.NoError(t, err)
+	dir := t.TempDir()
+	config := "glob = \"" + filepath.Join(mock, "*.md") + "\"\npipe = true\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, CONFIG_NAME), []byte(config), 0644))
+
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	out, _ := runMain(t, "science")
+	assert.Equal(t, "02.foo.md\n03.bar.md\n04.baz.md\n\n", out)
+
+	// an output asked for on the command line overrides the pipe of the config:
+	out, _ = runMain(t, "--verbose", "science")
+	assert.Contains(t, out, "[sums]")
+	out, _ = runMain(t, "--json", "science")
+	assert.Contains(t, out, `"sums": {`)
+}
+
+func TestFindConfigHome(t *testing.T) {
+	dir := t.TempDir()
+	old := home
+	home = func() (string, error) { return dir, nil }
+	t.Cleanup(func() { home = old })
+
+	_, ok := FindConfig()
+	assert.False(t, ok)
+
+	path := filepath.Join(dir, CONFIG_NAME)
+	assert.NoError(t, os.WriteFile(path, []byte("pipe = true\n"), 0644))
+	found, ok := FindConfig()
+	assert.True(t, ok)
+	assert.Equal(t, path, found)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the clock relative dates are resolved against, replaced in tests.
+var now = time.Now
+
+// matches a relative date: a number of days, weeks or months ago.
+var RELATIVE_DATE = regexp.MustCompile(`^(\d+)([dwm])$`)
+
+// parses a relative date into the day it names: 7d is the day a week ago, 2w
+// two weeks ago and 1m a month ago, besides today and yesterday.
+func ParseRelativeDate(date string) (from time.Time, to time.Time, ok bool) {
+	y, m, d := now().Date()
+	// dates in files parse as UTC, so today must be too:
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	tomorrow := today.AddDate(0, 0, 1)
+	switch date {
+	case "today":
+		return today, tomorrow, true
+	case "yesterday":
+		return today.AddDate(0, 0, -1), today, true
+	}
+	res := RELATIVE_DATE.FindStringSubmatch(date)
+	if res == nil {
+		return from, to, false
+	}
+	n, _ := strconv.Atoi(res[1])
+	switch res[2] {
+	case "d":
+		from = today.AddDate(0, 0, -n)
+	case "w":
+		from = today.AddDate(0, 0, -7*n)
+	case "m":
+		from = today.AddDate(0, -n, 0)
+	}
+	return from, from.AddDate(0, 0, 1), true
+}
+
+// parses a date into the range of time it covers, from inclusive to exclusive.
+// the precision follows the number of dotted parts: 2024 covers the year,
+// 2024.09 the month, and 2024.09.25 the day, while 2024.09.25 14:30 covers only
+// that minute. relative dates like 7d or today are resolved against the clock.
+func ParsePartialDate(date string) (from time.Time, to time.Time, err error) {
+	if from, to, ok := ParseRelativeDate(date); ok {
+		return from, to, nil
+	}
+	if strings.Contains(date, " ") {
+		from, err = time.Parse(DATE_FORMAT+" "+TIME_LAYOUT, date)
+		return from, from.Add(time.Minute), err
+	}
+	switch strings.Count(date, ".") {
+	case 0:
+		from, err = time.Parse("2006", date)
+		to = from.AddDate(1, 0, 0)
+	case 1:
+		from, err = time.Parse("2006.01", date)
+		to = from.AddDate(0, 1, 0)
+	case 2:
+		from, err = time.Parse(DATE_FORMAT, date)
+		to = from.AddDate(0, 0, 1)
+	default:
+		err = fmt.Errorf("too many parts in date %q", date)
+	}
+	return from, to, err
+}
+
+// parses a single date, or a range of two joined by -, into the time it covers.
+// partial dates cover their whole period, so 2024.09-2024.10 runs from the start
+// of September through the end of October, and 7d-yesterday the week before
+// today. a bare 7d, 2w or 1m runs through today.
+//
+// either bound failing to parse is an error, rather than a zero time leaving the
+// range open.
+func ParseDateRange(date string) (from time.Time, to time.Time, err error) {
+	start, end, ok := strings.Cut(date, "-")
+	if !ok {
+		end = start
+		if RELATIVE_DATE.MatchString(start) {
+			end = "today"
+		}
+	}
+	if from, _, err = ParsePartialDate(start); err != nil {
+		return from, to, fmt.Errorf("bad start %q of date range %q: %w", start, date, err)
+	}
+	if _, to, err = ParsePartialDate(end); err != nil {
+		return from, to, fmt.Errorf("bad end %q of date range %q: %w", end, date, err)
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("date range %q ends before it starts", date)
+	}
+	return from, to, nil
+}
+
+// filters the files down to those dated within the date or range of dates, or
+// within any of several joined by a comma. files without a date never match.
+func Date(entries []Entry, files Set, date string) (Set, error) {
+	dated := Set{}
+	for _, r := range strings.Split(date, ",") {
+		from, to, err := ParseDateRange(strings.TrimSpace(r))
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if files[e.filename] && !e.date.IsZero() && !e.date.Before(from) && e.date.Before(to) {
+				dated[e.filename] = true
+			}
+		}
+	}
+	return dated, nil
+}
+
+// filters the files down to those dated on or after since and on or before
+// until, either of which may be any date Date takes. without an until, the range
+// runs through today, and without a since, from as far back as there are files.
+func Between(entries []Entry, files Set, since string, until string) (Set, error) {
+	var from time.Time
+	_, to, _ := ParseRelativeDate("today")
+	var err error
+	if since != "" {
+		if from, _, err = ParsePartialDate(since); err != nil {
+			return nil, err
+		}
+	}
+	if until != "" {
+		if _, to, err = ParsePartialDate(until); err != nil {
+			return nil, err
+		}
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("--since %q is after --until %q", since, until)
+	}
+	between := Set{}
+	for _, e := range entries {
+		if files[e.filename] && !e.date.IsZero() && !e.date.Before(from) && e.date.Before(to) {
+			between[e.filename] = true
+		}
+	}
+	return between, nil
+}
+
+// the entries with each missing date filled in by the day the file was last
+// modified, in a new slice. dates from the header are kept as they are.
+func MtimeDates(entries []Entry) []Entry {
+	dated := []Entry{}
+	for _, e := range entries {
+		if e.date.IsZero() && !e.mtime.IsZero() {
+			y, m, d := e.mtime.Date()
+			e.date = time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+		}
+		dated = append(dated, e)
+	}
+	return dated
+}
+
+// filters the files down to the newest percent of them by date. the cutoff is
+// the date of the last file within the percent, and every file dated on or after
+// it is kept, so files sharing a date are never split. files without a date
+// never match.
+func Recent(entries []Entry, files Set, percent float64) (Set, error) {
+	if percent <= 0 || percent > 100 {
+		return nil, fmt.Errorf("recent percent %v must be above 0 and at most 100", percent)
+	}
+	dates := []time.Time{}
+	for _, e := range entries {
+		if files[e.filename] && !e.date.IsZero() {
+			dates = append(dates, e.date)
+		}
+	}
+	recent := Set{}
+	if len(dates) == 0 {
+		return recent, nil
+	}
+	slices.SortFunc(dates, func(a, b time.Time) int { return b.Compare(a) })
+	n := int(math.Ceil(float64(len(dates)) * percent / 100))
+	cutoff := dates[n-1]
+	for _, e := range entries {
+		if files[e.filename] && !e.date.IsZero() && !e.date.Before(cutoff) {
+			recent[e.filename] = true
+		}
+	}
+	return recent, nil
+}
+
+// layouts which group dates into buckets of a day, month or year.
+var BUCKETS = map[string]string{
+	"day":   DATE_FORMAT,
+	"month": "2006.01",
+	"year":  "2006",
+}
+
+// counts the files in each bucket of dates. files without a date are counted as
+// unknown.
+func ByDate(entries []Entry, files Set, bucket string) (map[string]int, error) {
+	layout, ok := BUCKETS[bucket]
+	if !ok {
+		return nil, fmt.Errorf("unknown bucket %q, expected day, month or year", bucket)
+	}
+	counts := map[string]int{}
+	for _, e := range entries {
+		if !files[e.filename] {
+			continue
+		}
+		if e.date.IsZero() {
+			counts["unknown"]++
+		} else {
+			counts[e.date.Format(layout)]++
+		}
+	}
+	return counts, nil
+}
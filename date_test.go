@@ -0,0 +1,348 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDateYear(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	files := ProcessQueries(entries, Tagmap(entries), ParseQuery("sot,science"))
+
+	dated, err := Date(entries, files, "2024")
+	assert.NoError(t, err)
+	assert.Equal(t, files, dated)
+
+	dated, err = Date(entries, files, "2023")
+	assert.NoError(t, err)
+	assert.Empty(t, dated)
+}
+
+func TestDateMonth(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	files := ProcessQueries(entries, Tagmap(entries), ParseQuery("sot,science"))
+
+	dated, err := Date(entries, files, "2024.09")
+	assert.NoError(t, err)
+	expected := Set{"01.foo.md": true, "02.foo.md": true, "03.bar.md": true}
+	assert.Equal(t, expected, dated)
+
+	dated, err = Date(entries, files, "2024.10")
+	assert.NoError(t, err)
+	assert.Equal(t, Set{"04.baz.md": true}, dated)
+}
+
+func TestDateDay(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	files := ProcessQueries(entries, Tagmap(entries), ParseQuery("sot,science"))
+
+	dated, err := Date(entries, files, "2024.10.09")
+	assert.NoError(t, err)
+	assert.Equal(t, Set{"04.baz.md": true}, dated)
+
+	dated, err = Date(entries, files, "2024.10.08")
+	assert.NoError(t, err)
+	assert.Empty(t, dated)
+}
+
+func TestDateRange(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	files := ProcessQueries(entries, Tagmap(entries), ParseQuery("sot,science"))
+
+	dated, err := Date(entries, files, "2024.09-2024.10")
+	assert.NoError(t, err)
+	assert.Equal(t, files, dated)
+
+	dated, err = Date(entries, files, "2024.09.26-2024.10.09")
+	assert.NoError(t, err)
+	assert.Equal(t, Set{"04.baz.md": true}, dated)
+
+	_, err = Date(entries, files, "2024.10-2024.09")
+	assert.Error(t, err)
+}
+
+func TestDateRanges(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse(DATE_FORMAT, s)
+		return d
+	}
+	entries := []Entry{
+		{filename: "jan.md", date: day("2024.01.15")},
+		{filename: "mar.md", date: day("2024.03.10")},
+		{filename: "jun.md", date: day("2024.06.30")},
+	}
+	files := Set{"jan.md": true, "mar.md": true, "jun.md": true}
+
+	// march falls between the two ranges:
+	dated, err := Date(entries, files, "2024.01.01-2024.01.31,2024.06.01-2024.06.30")
+	assert.NoError(t, err)
+	assert.Equal(t, Set{"jan.md": true, "jun.md": true}, dated)
+
+	// single dates mix with ranges:
+	dated, err = Date(entries, files, "2024.03.10, 2024.06")
+	assert.NoError(t, err)
+	assert.Equal(t, Set{"mar.md": true, "jun.md": true}, dated)
+
+	_, err = Date(entries, files, "2024.01,2024.06-2024.05")
+	assert.Error(t, err)
+}
+
+func TestDateTimeOfDay(t *testing.T) {
+	at := func(date string) time.Time {
+		d, _ := ParseDateLayouts(date)
+		return d
+	}
+	entries := []Entry{
+		{filename: "morning.md", date: at("2024.09.25 09:15")},
+		{filename: "afternoon.md", date: at("2024.09.25 14:30")},
+		{filename: "evening.md", date: at("2024.09.25 20:00")},
+		{filename: "undated.md", date: at("2024.09.25")},
+	}
+	files := Set{"morning.md": true, "afternoon.md": true, "evening.md": true, "undated.md": true}
+
+	dated, err := Date(entries, files, "2024.09.25 12:00-2024.09.25 18:00")
+	assert.NoError(t, err)
+	assert.Equal(t, Set{"afternoon.md": true}, dated)
+
+	// a single time covers its minute, and a date without a time is midnight:
+	dated, err = Date(entries, files, "2024.09.25 14:30,2024.09.25 00:00")
+	assert.NoError(t, err)
+	assert.Equal(t, Set{"afternoon.md": true, "undated.md": true}, dated)
+
+	// while the whole day still covers them all:
+	dated, err = Date(entries, files, "2024.09.25")
+	assert.NoError(t, err)
+	assert.Equal(t, files, dated)
+
+	_, err = Date(entries, files, "2024.09.25 25:00")
+	assert.Error(t, err)
+}
+
+// fixes the clock at the given moment for the length of the test.
+func fixClock(t *testing.T, moment string) {
+	fixed, _ := time.Parse(time.RFC3339, moment)
+	now = func() time.Time { return fixed }
+	t.Cleanup(func() { now = time.Now })
+}
+
+func TestSince(t *testing.T) {
+	fixClock(t, "2024-10-09T15:04:05Z")
+	entries := mockEntries(t, TEST_PATTERN)
+	files := ProcessQueries(entries, Tagmap(entries), ParseQuery("sot,science"))
+
+	between, err := Between(entries, files, "2024.09.26", "")
+	assert.NoError(t, err)
+	assert.Equal(t, Set{"04.baz.md": true}, between)
+
+	// through today, so never after it:
+	fixClock(t, "2024-10-08T15:04:05Z")
+	between, err = Between(entries, files, "2024.09.26", "")
+	assert.NoError(t, err)
+	assert.Empty(t, between)
+}
+
+func TestUntil(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	files := ProcessQueries(entries, Tagmap(entries), ParseQuery("sot,science"))
+
+	// the whole of the last day counts:
+	between, err := Between(entries, files, "", "2024.09.25")
+	assert.NoError(t, err)
+	assert.Equal(t, Set{"01.foo.md": true, "02.foo.md": true, "03.bar.md": true}, between)
+
+	between, err = Between(entries, files, "", "2024.09.24")
+	assert.NoError(t, err)
+	assert.Empty(t, between)
+}
+
+func TestSinceUntil(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	files := ProcessQueries(entries, Tagmap(entries), ParseQuery("sot,science,diff"))
+
+	between, err := Between(entries, files, "2024.10", "2024.10.09")
+	assert.NoError(t, err)
+	assert.Equal(t, Set{"04.baz.md": true, "05.quz.md": true}, between)
+
+	_, err = Between(entries, files, "2024.10", "2024.09")
+	assert.Error(t, err)
+	_, err = Between(entries, files, "soon", "")
+	assert.Error(t, err)
+
+	// the same through main:
+	out, _ := runMain(t, "--glob", TEST_PATTERN, "--pipe", "--since", "2024.10", "--until", "2024.10.09", "sot,science,diff")
+	assert.Equal(t, "04.baz.md\n05.quz.md\n\n", out)
+}
+
+func TestDateMtime(t *testing.T) {
+	dir := t.TempDir()
+	undated := filepath.Join(dir, "undated.md")
+	assert.NoError(t, os.WriteFile(undated, []byte("# undated.md\n+ foo\n\nFoo.\n"), 0644))
+	modified := time.Date(2024, 9, 25, 12, 0, 0, 0, time.Local)
+	assert.NoError(t, os.Chtimes(undated, modified, modified))
+	dated := filepath.Join(dir, "dated.md")
+	assert.NoError(t, os.WriteFile(dated, []byte("# dated.md\n: 2024.10.09\n+ foo\n\nFoo.\n"), 0644))
+	assert.NoError(t, os.Chtimes(dated, modified, modified))
+
+	entries := mockEntries(t, filepath.Join(dir, "*.md"))
+	files := Set{"undated.md": true, "dated.md": true}
+
+	// without a date line, a file never matches:
+	matched, err := Date(entries, files, "2024.09.25")
+	assert.NoError(t, err)
+	assert.Empty(t, matched)
+
+	// unless its mtime stands in, while the header date still wins:
+	matched, err = Date(MtimeDates(entries), files, "2024.09.25")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"undated.md"}, matched.Members())
+	matched, err = Date(MtimeDates(entries), files, "2024.10.09")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dated.md"}, matched.Members())
+
+	// --recent takes its dates from the same place as --date:
+	queries := ParseQuery("foo")
+	found, _, err := Search(entries, queries, SearchOptions{recent: 100})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dated.md"}, found.Members())
+	found, _, err = Search(entries, queries, SearchOptions{recent: 100, mtime: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dated.md", "undated.md"}, found.Members())
+	// the mtime falls before the header date, so only the dated file is newest:
+	found, _, err = Search(entries, queries, SearchOptions{recent: 50, mtime: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dated.md"}, found.Members())
+}
+
+func TestParseRelativeDate(t *testing.T) {
+	fixClock(t, "2024-10-09T15:04:05Z")
+	day := func(date string) time.Time {
+		d, _ := time.Parse(DATE_FORMAT, date)
+		return d
+	}
+
+	cases := map[string][2]string{
+		"today":     {"2024.10.09", "2024.10.10"},
+		"yesterday": {"2024.10.08", "2024.10.09"},
+		"7d":        {"2024.10.02", "2024.10.10"},
+		"2w":        {"2024.09.25", "2024.10.10"},
+		"1m":        {"2024.09.09", "2024.10.10"},
+		"7d-2d":     {"2024.10.02", "2024.10.08"},
+	}
+	for date, expected := range cases {
+		from, to, err := ParseDateRange(date)
+		assert.NoError(t, err, date)
+		assert.Equal(t, day(expected[0]), from, date)
+		assert.Equal(t, day(expected[1]), to, date)
+	}
+
+	from, to, err := ParseDateRange("7d-yesterday")
+	assert.NoError(t, err)
+	assert.Equal(t, day("2024.10.02"), from)
+	assert.Equal(t, day("2024.10.09"), to)
+
+	_, _, err = ParseDateRange("today-7d")
+	assert.Error(t, err)
+	_, _, err = ParseDateRange("7y")
+	assert.Error(t, err)
+}
+
+func TestDateBadBounds(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	files := ProcessQueries(entries, Tagmap(entries), ParseQuery("sot,science"))
+
+	_, err := Date(entries, files, "garbage-2024.09.30")
+	assert.ErrorContains(t, err, `bad start "garbage" of date range "garbage-2024.09.30"`)
+	_, err = Date(entries, files, "2024.09.01-garbage")
+	assert.ErrorContains(t, err, `bad end "garbage" of date range "2024.09.01-garbage"`)
+	_, err = Date(entries, files, "-2024.09.30")
+	assert.ErrorContains(t, err, "bad start")
+	// in any of several ranges:
+	_, err = Date(entries, files, "2024.09,2024.10-garbage")
+	assert.ErrorContains(t, err, "bad end")
+}
+
+func TestDateRelative(t *testing.T) {
+	fixClock(t, "2024-10-10T09:00:00Z")
+	entries := mockEntries(t, TEST_PATTERN)
+	files := ProcessQueries(entries, Tagmap(entries), ParseQuery("sot,science"))
+
+	dated, err := Date(entries, files, "yesterday")
+	assert.NoError(t, err)
+	assert.Equal(t, Set{"04.baz.md": true}, dated)
+
+	dated, err = Date(entries, files, "1m")
+	assert.NoError(t, err)
+	assert.Equal(t, files, dated)
+
+	dated, err = Date(entries, files, "today")
+	assert.NoError(t, err)
+	assert.Empty(t, dated)
+}
+
+func TestByDate(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	files := ProcessQueries(entries, Tagmap(entries), ParseQuery("sot,science"))
+
+	counts, err := ByDate(entries, files, "day")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"2024.09.25": 3, "2024.10.09": 1}, counts)
+
+	counts, err = ByDate(entries, files, "year")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"2024": 4}, counts)
+
+	undated := []Entry{{filename: "a.md"}}
+	counts, err = ByDate(undated, Set{"a.md": true}, "month")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"unknown": 1}, counts)
+
+	_, err = ByDate(entries, files, "week")
+	assert.Error(t, err)
+}
+
+func TestRecent(t *testing.T) {
+	entries := []Entry{{filename: "undated.md"}}
+	files := Set{"undated.md": true}
+	start, _ := time.Parse(DATE_FORMAT, "2024.01.01")
+	for i := range 10 {
+		name := fmt.Sprintf("%02d.md", i)
+		entries = append(entries, Entry{filename: name, date: start.AddDate(0, 0, i)})
+		files[name] = true
+	}
+
+	recent, err := Recent(entries, files, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, Set{"09.md": true}, recent)
+
+	recent, err = Recent(entries, files, 25)
+	assert.NoError(t, err)
+	assert.Equal(t, Set{"07.md": true, "08.md": true, "09.md": true}, recent)
+
+	recent, err = Recent(entries, files, 100)
+	assert.NoError(t, err)
+	assert.Len(t, recent, 10)
+
+	_, err = Recent(entries, files, 0)
+	assert.Error(t, err)
+	_, err = Recent(entries, files, 101)
+	assert.Error(t, err)
+}
+
+func TestRecentKeepsSharedDates(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	files := ProcessQueries(entries, Tagmap(entries), ParseQuery("sot,science"))
+
+	recent, err := Recent(entries, files, 25)
+	assert.NoError(t, err)
+	assert.Equal(t, Set{"04.baz.md": true}, recent)
+
+	// the second newest file shares its date with two others.
+	recent, err = Recent(entries, files, 50)
+	assert.NoError(t, err)
+	assert.Equal(t, files, recent)
+}
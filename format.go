@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// functions a --format template may call, beyond the builtins.
+var FORMAT_FUNCS = template.FuncMap{
+	"join": strings.Join,
+}
+
+// parses a --format template, executed for each file with the fields of its
+// Entry.
+func ParseFormat(format string) (*template.Template, error) {
+	return template.New("format").Funcs(FORMAT_FUNCS).Option("missingkey=error").Parse(format)
+}
+
+// the fields of an entry by their names, for templates, which can't reach the
+// unexported fields of the struct. so {{.date.Year}} works as it reads.
+func (e Entry) Fields() map[string]any {
+	return map[string]any{
+		"filename":   e.filename,
+		"date":       e.date,
+		"tags":       e.tags,
+		"content":    e.content,
+		"mtime":      e.mtime,
+		"number":     e.number,
+		"collection": e.collection,
+	}
+}
+
+// executes the template once per file, each on its own line, ordered as Print
+// would.
+func PrintFormat(w io.Writer, collection map[string]Set, entries []Entry, tmpl *template.Template, opts PrintOptions) error {
+	entrymap := EntryMap(entries)
+	for _, f := range OrderFiles(entries, collection["files"], opts) {
+		if err := tmpl.Execute(w, entrymap[f].Fields()); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintFormat(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("science")
+	collection := Collect(entries, Tagmap(entries), queries)
+
+	tmpl, err := ParseFormat(`{{.filename}}	{{.date.Year}}	{{join .tags ","}}`)
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	err = PrintFormat(&buf, collection, entries, tmpl, PrintOptions{})
+	assert.NoError(t, err)
+	expected := "02.foo.md\t2024\tsot,science\n03.bar.md\t2024\tsot,science\n04.baz.md\t2024\tscience\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestParseFormatErrors(t *testing.T) {
+	_, err := ParseFormat(`{{.filename`)
+	assert.Error(t, err)
+	_, err = ParseFormat(`{{nope .filename}}`)
+	assert.Error(t, err)
+
+	// unknown fields fail on execution rather than printing <no value>:
+	tmpl, err := ParseFormat(`{{.nope}}`)
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	assert.Error(t, tmpl.Execute(&buf, Entry{}.Fields()))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fences a block of YAML front matter at the very top of a file, as written by
+// Jekyll or Obsidian.
+const FRONT_MATTER_FENCE = "---\n"
+
+// the keys of front matter which map onto an Entry.
+type FrontMatter struct {
+	Date string   `yaml:"date"`
+	Tags []string `yaml:"tags"`
+}
+
+// splits the YAML front matter from the body following it. ok is false for a
+// file which doesn't open with a fence, or never closes it.
+func CutFrontMatter(content *string) (matter string, body string, ok bool) {
+	rest, ok := strings.CutPrefix(*content, FRONT_MATTER_FENCE)
+	if !ok {
+		return "", "", false
+	}
+	if matter, body, ok = strings.Cut(rest, "\n"+FRONT_MATTER_FENCE); ok {
+		return matter + "\n", body, true
+	}
+	// closed at the very end of the file:
+	if matter, ok = strings.CutSuffix(rest, "\n---"); ok {
+		return matter + "\n", "", true
+	}
+	return "", "", false
+}
+
+// parses the date and tags of YAML front matter. tags may be a flow list like
+// [a, b] or a block list, and the date in any of the DATE_LAYOUTS.
+func ParseFrontMatter(matter string) (time.Time, []string, error) {
+	fm := FrontMatter{}
+	if err := yaml.Unmarshal([]byte(matter), &fm); err != nil {
+		return time.Time{}, nil, err
+	}
+	if fm.Date == "" {
+		return time.Time{}, fm.Tags, errors.New("failed to find date in front matter")
+	}
+	date, err := ParseDateLayouts(fm.Date)
+	return date, fm.Tags, err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCutFrontMatter(t *testing.T) {
+	content := "---\ndate: 2024-09-25\n---\n\nBody.\n"
+	matter, body, ok := CutFrontMatter(&content)
+	assert.True(t, ok)
+	assert.Equal(t, "date: 2024-09-25\n", matter)
+	assert.Equal(t, "\nBody.\n", body)
+
+	content = "---\ndate: 2024-09-25\n---"
+	matter, body, ok = CutFrontMatter(&content)
+	assert.True(t, ok)
+	assert.Equal(t, "date: 2024-09-25\n", matter)
+	assert.Empty(t, body)
+
+	for _, content := range []string{"# a.md\n: 2024.09.25\n", "---\ndate: 2024-09-25\n"} {
+		_, _, ok := CutFrontMatter(&content)
+		assert.False(t, ok, content)
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	expected, _ := time.Parse(DATE_FORMAT, "2024.09.25")
+
+	date, tags, err := ParseFrontMatter("date: 2024-09-25\ntags: [a, b]\n")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, date)
+	assert.Equal(t, []string{"a", "b"}, tags)
+
+	date, tags, err = ParseFrontMatter("date: 2024.09.25\ntags:\n  - a\n")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, date)
+	assert.Equal(t, []string{"a"}, tags)
+
+	_, tags, err = ParseFrontMatter("tags: [a]\n")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"a"}, tags)
+
+	_, _, err = ParseFrontMatter("date: someday\n")
+	assert.Error(t, err)
+}
+
+func TestFrontMatterEntries(t *testing.T) {
+	entries := mockEntries(t, "./mock/frontmatter/*.md")
+	assert.Len(t, entries, 3)
+
+	flow, block, plain := entries[0], entries[1], entries[2]
+	assert.Equal(t, []string{"sot", "science"}, flow.tags)
+	assert.Equal(t, "2024.09.25", FormatDate(flow.date))
+	assert.Equal(t, []string{"sot", "foo"}, block.tags)
+	assert.Equal(t, "2024.10.09", FormatDate(block.date))
+	assert.Equal(t, "Block body.\n", ParseBody(&block.content))
+	// the usual header still works alongside:
+	assert.Equal(t, []string{"foo"}, plain.tags)
+	assert.Equal(t, "2024.10.10", FormatDate(plain.date))
+
+	files := ProcessQueries(entries, Tagmap(entries), ParseQuery("foo"))
+	assert.Equal(t, Set{"02.block.md": true, "03.plain.md": true}, files)
+}
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -9,15 +13,22 @@ import (
 
 const TEST_PATTERN string = "./mock/*.md"
 
+// the entries of the files matching the pattern, failing the test on an error.
+func mockEntries(t *testing.T, pattern string) []Entry {
+	entries, err := Entries(pattern)
+	assert.NoError(t, err)
+	return entries
+}
+
 func TestParseHeader(t *testing.T) {
-	entries := Entries(TEST_PATTERN)
+	entries := mockEntries(t, TEST_PATTERN)
 	header := ParseHeader(&entries[0].content)
 	expected := "# 01.foo.md\n: 2024.09.25\n+ sot\n+ foo"
 	assert.Equal(t, expected, header)
 }
 
 func TestEntriesLen(t *testing.T) {
-	entries := Entries(TEST_PATTERN)
+	entries := mockEntries(t, TEST_PATTERN)
 	expected := 6
 	if len(entries) != expected {
 		t.Errorf("entries should be len == %v, got %v", expected, len(entries))
@@ -25,28 +36,223 @@ func TestEntriesLen(t *testing.T) {
 }
 
 func TestEntries(t *testing.T) {
-	entries := Entries(TEST_PATTERN)
+	entries := mockEntries(t, TEST_PATTERN)
 	d, _ := time.Parse("2006.01.02", "2024.09.25")
-	expected := Entry{filename: "01.foo.md", date: d, content: "# 01.foo.md\n: 2024.09.25\n+ sot\n+ foo\n\nFoo bar.\n", tags: []string{"sot", "foo"}}
+	info, _ := os.Stat("./mock/01.foo.md")
+	expected := Entry{filename: "01.foo.md", date: d, content: "# 01.foo.md\n: 2024.09.25\n+ sot\n+ foo\n\nFoo bar.\n", tags: []string{"sot", "foo"}, mtime: info.ModTime(), path: "mock/01.foo.md"}
 	assert.Equal(t, expected, entries[0])
 }
 
+func TestParseContentDate(t *testing.T) {
+	content := "# a.md\n: 2024.09.25\n+ foo\n"
+	e, err := ParseContent("a.md", &content, ReadOptions{})
+	assert.NoError(t, err)
+	assert.False(t, e.date.IsZero())
+
+	for _, content := range []string{"# a.md\n+ foo\n", "# a.md\n: someday\n+ foo\n"} {
+		e, err := ParseContent("a.md", &content, ReadOptions{})
+		assert.Error(t, err, content)
+		assert.True(t, e.date.IsZero())
+		assert.Equal(t, []string{"foo"}, e.tags)
+	}
+}
+
+func TestEmptyFiles(t *testing.T) {
+	var stderr bytes.Buffer
+	warnings = &stderr
+	defer func() { warnings = os.Stderr }()
+
+	entries := mockEntries(t, "./mock/empty/*.md")
+	assert.Len(t, entries, 4)
+	// neither the empty nor the blank file is warned about as undated:
+	assert.Empty(t, stderr.String())
+	for _, e := range entries[:2] {
+		assert.Empty(t, e.tags, e.filename)
+		assert.True(t, e.date.IsZero(), e.filename)
+	}
+	// the whole of a header without a body is still read:
+	assert.Equal(t, []string{"foo", "sot"}, entries[2].tags)
+	assert.Equal(t, "2024.10.10", FormatDate(entries[2].date))
+	assert.Empty(t, ParseBody(&entries[2].content))
+
+	tagmap := Tagmap(entries)
+	assert.Equal(t, map[string]Set{
+		"foo": {"03.header.md": true, "04.note.md": true},
+		"sot": {"03.header.md": true},
+	}, tagmap)
+	assert.Equal(t, Set{"01.empty.md": true, "02.blank.md": true}, Invert(entries, ProcessQueries(entries, tagmap, ParseQuery("foo"))))
+	assert.Equal(t, 2, WordCount(entries, Invert(entries, Set{})))
+}
+
+func TestParseDateLayouts(t *testing.T) {
+	expected, _ := time.Parse(DATE_FORMAT, "2024.09.25")
+	for _, date := range []string{"2024.09.25", "2024-09-25", "2024/09/25"} {
+		header := "# a.md\n: " + date + "\n+ foo\n"
+		d, err := ParseDate(&header, "")
+		assert.NoError(t, err, date)
+		assert.Equal(t, expected, d, date)
+	}
+
+	header := "# a.md\n: 25.09.2024\n+ foo\n"
+	_, err := ParseDate(&header, "")
+	assert.Error(t, err)
+}
+
+func TestParseDateTime(t *testing.T) {
+	expected := time.Date(2024, 9, 25, 14, 30, 0, 0, time.UTC)
+	for _, date := range []string{"2024.09.25 14:30", "2024-09-25 14:30"} {
+		header := "# a.md\n: " + date + "\n+ foo\n"
+		d, err := ParseDate(&header, "")
+		assert.NoError(t, err, date)
+		assert.Equal(t, expected, d, date)
+	}
+
+	header := "# a.md\n: 2024.09.25 2pm\n+ foo\n"
+	_, err := ParseDate(&header, "")
+	assert.Error(t, err)
+}
+
+func TestMarkers(t *testing.T) {
+	files, err := Filelist("./mock/markers/*.md")
+	assert.NoError(t, err)
+	entries, err := ReadEntries(files, ReadOptions{tagmarker: "@", datemarker: "date: "})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"science", "sot"}, entries[0].tags)
+	assert.Equal(t, "2024.09.25", FormatDate(entries[0].date))
+
+	// the defaults still read + lines, and find no date:
+	entries, err = ReadEntries(files, ReadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"plus"}, entries[0].tags)
+	assert.True(t, entries[0].date.IsZero())
+
+	// special characters are taken literally:
+	header := "# a.md\n*.tag\n+ foo\nx.tag\n"
+	tags, _ := ParseTags(&header, "*.")
+	assert.Equal(t, []string{"tag"}, tags)
+}
+
+func TestReadEntriesUndated(t *testing.T) {
+	dir := t.TempDir()
+	dated := filepath.Join(dir, "dated.md")
+	undated := filepath.Join(dir, "undated.md")
+	os.WriteFile(dated, []byte("# dated.md\n: 2024.09.25\n+ foo\n"), 0644)
+	os.WriteFile(undated, []byte("# undated.md\n: someday\n+ foo\n"), 0644)
+
+	var stderr bytes.Buffer
+	warnings = &stderr
+	defer func() { warnings = os.Stderr }()
+
+	entries, err := ReadEntries([]string{dated, undated}, ReadOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "warning: failed to parse a date in 1 files: "+undated+"\n", stderr.String())
+}
+
+func TestReadEntriesCollisions(t *testing.T) {
+	a := filepath.Join(t.TempDir(), "note.md")
+	b := filepath.Join(t.TempDir(), "note.md")
+	os.WriteFile(a, []byte("# note.md\n: 2024.09.25\n+ foo\n"), 0644)
+	os.WriteFile(b, []byte("# note.md\n: 2024.09.25\n+ bar\n"), 0644)
+
+	var stderr bytes.Buffer
+	warnings = &stderr
+	defer func() { warnings = os.Stderr }()
+
+	entries, err := ReadEntries([]string{a, b}, ReadOptions{})
+	assert.NoError(t, err)
+	expected := "warning: 2 files share the name note.md, use --full-path to keep them apart: " + a + ", " + b + "\n"
+	assert.Equal(t, expected, stderr.String())
+	// shadowing each other's tags:
+	assert.Equal(t, Set{"note.md": true}, Tagmap(entries)["foo"].Union(Tagmap(entries)["bar"]))
+
+	stderr.Reset()
+	entries, err = ReadEntries([]string{a, b}, ReadOptions{fullpath: true})
+	assert.NoError(t, err)
+	assert.Empty(t, stderr.String())
+	assert.Equal(t, Set{a: true}, Tagmap(entries)["foo"])
+	assert.Equal(t, Set{b: true}, Tagmap(entries)["bar"])
+}
+
+func TestReadEntriesRelative(t *testing.T) {
+	files, err := Filelist("./mock/nested/*/note.md")
+	assert.NoError(t, err)
+	entries, err := ReadEntries(files, ReadOptions{fullpath: true, root: CommonRoot([]string{"./mock/nested/*/note.md"})})
+	assert.NoError(t, err)
+
+	tagmap := Tagmap(entries)
+	assert.Equal(t, Set{"a/note.md": true, "b/note.md": true}, tagmap["sot"])
+	assert.Equal(t, Set{"a/note.md": true}, tagmap["foo"])
+	assert.Equal(t, Set{"b/note.md": true}, Invert(entries, tagmap["foo"]))
+	// neither file shadows the other's tags:
+	assert.Equal(t, Set{"foo": true, "bar": true}, Adjacencies(entries)["sot"])
+
+	out, _ := runMain(t, "--glob", "mock/nested/*/note.md", "--full-path", "--pipe", "sot")
+	assert.Equal(t, "a/note.md\nb/note.md\n\n", out)
+	// outside the root, the whole path is kept:
+	assert.Equal(t, "../mock/01.foo.md", RelativeName("../mock/01.foo.md", "mock"))
+}
+
+func TestHashtags(t *testing.T) {
+	files, err := Filelist("./mock/hashtags/*.md")
+	assert.NoError(t, err)
+
+	entries, err := ReadEntries(files, ReadOptions{hashtags: true})
+	assert.NoError(t, err)
+	// neither the headings nor the fragment of the link:
+	assert.Equal(t, []string{"foo", "idea", "aside", "proj/gag"}, entries[0].tags)
+	assert.Equal(t, map[string]int{"idea": 1, "foo": 1}, entries[0].repeats)
+
+	entries, err = ReadEntries(files, ReadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, entries[0].tags)
+}
+
+func TestListFiles(t *testing.T) {
+	out, errs := runMain(t, "--glob", "./mock/0[4-6]*.md", "--glob", "mock/01.foo.md", "--exclude-glob", "mock/06*", "--list-files")
+	assert.Equal(t, "mock/01.foo.md\nmock/04.baz.md\nmock/05.quz.md\n", out)
+	// without reading a thing, so no warning about 06.quz.md either way:
+	assert.Empty(t, errs)
+}
+
 func TestTagmap(t *testing.T) {
-	entries := Entries(TEST_PATTERN)
+	entries := mockEntries(t, TEST_PATTERN)
 	tagmap := Tagmap(entries)
 	expected := Set{"01.foo.md": true, "02.foo.md": true, "03.bar.md": true}
 	assert.Equal(t, expected, tagmap["sot"])
 }
 
 func TestAdjacencies(t *testing.T) {
-	entries := Entries(TEST_PATTERN)
+	entries := mockEntries(t, TEST_PATTERN)
 	adjacencies := Adjacencies(entries)
 	expected := Set{"science": true, "foo": true}
 	assert.Equal(t, expected, adjacencies["sot"])
 }
 
+func TestAdjacencyCounts(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	counts := AdjacencyCounts(entries)
+	assert.Equal(t, map[string]int{"science": 2, "foo": 1}, counts["sot"])
+	assert.Equal(t, map[string]int{"sot": 2}, counts["science"])
+	assert.Empty(t, counts["diff"])
+
+	// a tag repeated in a file neither counts twice nor neighbors itself:
+	repeated := AdjacencyCounts([]Entry{{filename: "a.md", tags: []string{"foo", "bar", "foo"}}})
+	assert.Equal(t, map[string]map[string]int{"foo": {"bar": 1}, "bar": {"foo": 1}}, repeated)
+
+	// the same as the weights of the files carrying each tag:
+	tagmap := Tagmap(entries)
+	adjacencies := Adjacencies(entries)
+	for tag := range adjacencies {
+		weights := SharedWeights(entries, tagmap[tag], adjacencies[tag])
+		for other, n := range counts[tag] {
+			assert.Equal(t, weights[other], n, tag+" "+other)
+		}
+	}
+}
+
 func TestGrep(t *testing.T) {
-	entries := Entries(TEST_PATTERN)
+	entries := mockEntries(t, TEST_PATTERN)
 	queries := ParseQuery("foo")
 	tagmap := Tagmap(entries)
 
@@ -56,7 +262,7 @@ func TestGrep(t *testing.T) {
 }
 
 func TestBadTag(t *testing.T) {
-	entries := Entries(TEST_PATTERN)
+	entries := mockEntries(t, TEST_PATTERN)
 	queries := ParseQuery("qaz")
 	tagmap := Tagmap(entries)
 
@@ -69,7 +275,7 @@ func TestBadTag(t *testing.T) {
 }
 
 func TestFind(t *testing.T) {
-	entries := Entries(TEST_PATTERN)
+	entries := mockEntries(t, TEST_PATTERN)
 	queries := ParseQuery("baz")
 	tagmap := Tagmap(entries)
 
@@ -79,7 +285,7 @@ func TestFind(t *testing.T) {
 }
 
 func TestDiff(t *testing.T) {
-	entries := Entries(TEST_PATTERN)
+	entries := mockEntries(t, TEST_PATTERN)
 	queries := ParseQuery("diff")
 	tagmap := Tagmap(entries)
 	tagmap = Grep(entries, tagmap, queries)
@@ -88,3 +294,968 @@ func TestDiff(t *testing.T) {
 	expected := Set{"06.quz.md": true}
 	assert.Equal(t, expected, tagmap["diff"])
 }
+
+func TestTopTags(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	tagmap := Tagmap(entries)
+
+	// science and sot are tied at 3 files, so order falls back to name:
+	expected := []string{"science", "sot"}
+	assert.Equal(t, expected, TopTags(tagmap, 2))
+}
+
+func TestSimilarity(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("sot,science")
+	tagmap := Tagmap(entries)
+	collection := Collect(entries, tagmap, queries)
+
+	scores := Similarity(entries, collection["files"], queries)
+	expected := []Score{
+		{"02.foo.md", 1},
+		{"03.bar.md", 1},
+		{"04.baz.md", 0.5},
+		{"01.foo.md", 1.0 / 3},
+	}
+	assert.Equal(t, expected, scores)
+}
+
+func TestSimilarityLimit(t *testing.T) {
+	// the best matches first, cut to the limit:
+	out, _ := runMain(t, "--glob", TEST_PATTERN, "--similarity", "--limit", "1", "sot,science")
+	assert.Equal(t, "[similarity]\n02.foo.md = 1.00\n", out)
+}
+
+func TestMatchTagsSubstring(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	tagmap := Tagmap(entries)
+	assert.Equal(t, []string{"science"}, MatchTags(tagmap, "*sci*"))
+
+	collection := Collect(entries, tagmap, ParseQuery("*sci*"))
+	expected := Set{"02.foo.md": true, "03.bar.md": true, "04.baz.md": true}
+	assert.Equal(t, expected, collection["files"])
+}
+
+func TestMatchTagsInfix(t *testing.T) {
+	tagmap := map[string]Set{"pie": {}, "prose": {}, "pearl": {}, "ape": {}, "p": {}}
+	assert.Equal(t, []string{"pie", "prose"}, MatchTags(tagmap, "p*e"))
+	assert.Equal(t, []string{"pearl"}, MatchTags(tagmap, "pearl"))
+	assert.Equal(t, []string{}, MatchTags(tagmap, "q*"))
+}
+
+func TestMatchTagsRegex(t *testing.T) {
+	entries := []Entry{
+		{filename: "a.md", tags: []string{"proj-gag", "draft"}},
+		{filename: "b.md", tags: []string{"proj-um"}},
+		{filename: "c.md", tags: []string{"subproj-x", "draft"}},
+	}
+	tagmap := Tagmap(entries)
+	// anchored, so subproj-x doesn't match:
+	assert.Equal(t, []string{"proj-gag", "proj-um"}, MatchTags(tagmap, "re:proj-.*"))
+
+	queries := ParseQuery("re:proj-.*")
+	assert.NoError(t, CheckPatterns(queries))
+	assert.Equal(t, Set{"a.md": true, "b.md": true}, ProcessQueries(entries, tagmap, queries))
+
+	// the operators still apply between patterns:
+	queries = ParseQuery("re:proj-.*!re:dr.ft")
+	assert.Equal(t, Set{"b.md": true}, ProcessQueries(entries, tagmap, queries))
+	queries = RegexQuery("proj-.*!dr.ft")
+	assert.Equal(t, Set{"b.md": true}, ProcessQueries(entries, tagmap, queries))
+	queries = RegexQuery("proj-.*,sub.*")
+	assert.Equal(t, Set{"a.md": true, "b.md": true, "c.md": true}, ProcessQueries(entries, tagmap, queries))
+	queries = RegexQuery("proj-.*+dr.ft")
+	assert.Equal(t, Set{"a.md": true}, ProcessQueries(entries, tagmap, queries))
+	queries = ParseQuery("proj-um,draft+-re:sub.*")
+	assert.Equal(t, Set{"a.md": true, "b.md": true}, ProcessQueries(entries, tagmap, queries))
+}
+
+func TestParseQueryRegex(t *testing.T) {
+	// the operators in a pattern are left to it:
+	expected := Query{[]string{"re:proj-.+"}, [][]string{{"re:proj-.+"}}, [][]string{{}}}
+	assert.Equal(t, expected, ParseQuery("re:proj-.+"))
+	expected = Query{[]string{"re:a{1,3}"}, [][]string{{"re:a{1,3}"}}, [][]string{{}}}
+	assert.Equal(t, expected, ParseQuery("re:a{1,3}"))
+	expected = Query{[]string{"re:(a|b)+", "c"}, [][]string{{"re:(a|b)+", "c"}}, [][]string{{}}}
+	assert.Equal(t, expected, ParseQuery("re:(a|b)++c"))
+	expected = Query{[]string{`re:a\++`, "c"}, [][]string{{`re:a\++`}, {"c"}}, [][]string{{}, {}}}
+	assert.Equal(t, expected, ParseQuery(`re:a\++,c`))
+
+	// anywhere in the query, alongside plain tags:
+	expected = Query{
+		[]string{"re:a{1,3}", "foo", "bar"},
+		[][]string{{"re:a{1,3}", "foo"}, {"bar"}},
+		[][]string{{"re:x.+"}, {"re:x.+"}},
+	}
+	assert.Equal(t, expected, ParseQuery("re:a{1,3}+foo,bar!re:x.+"))
+	// but a plain tag is split as ever:
+	expected = Query{[]string{"a.", ""}, [][]string{{"a.", ""}}, [][]string{{}}}
+	assert.Equal(t, expected, ParseQuery("a.+"))
+
+	// re: inside a tag marks nothing:
+	expected = Query{[]string{"are:x", "y"}, [][]string{{"are:x"}, {"y"}}, [][]string{{}, {}}}
+	assert.Equal(t, expected, ParseQuery("are:x,y"))
+
+	// --regex reads every tag so:
+	expected = Query{
+		[]string{"re:fo.*", "re:sci.+", "re:a{1,3}"},
+		[][]string{{"re:fo.*", "re:sci.+"}, {"re:a{1,3}"}},
+		[][]string{{"re:dr.ft"}, {"re:dr.ft"}},
+	}
+	assert.Equal(t, expected, RegexQuery("fo.*+sci.+,a{1,3}!dr.ft"))
+}
+
+func TestRegexFlag(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.md"), []byte("# a.md\n+ proj-gag\n+ foo\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.md"), []byte("# b.md\n+ aaa\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "c.md"), []byte("# c.md\n+ proj-\n+ science\n"), 0644)
+	glob := filepath.Join(dir, "*.md")
+
+	out, _ := runMain(t, "--glob", glob, "--pipe", "--regex", "proj-.+")
+	assert.Equal(t, "a.md\n\n", out)
+	out, _ = runMain(t, "--glob", glob, "--pipe", "--regex", "a{1,3}")
+	assert.Equal(t, "b.md\n\n", out)
+	out, _ = runMain(t, "--glob", glob, "--pipe", "--regex", "fo.*,sci.*")
+	assert.Equal(t, "a.md\nc.md\n\n", out)
+	out, _ = runMain(t, "--glob", glob, "--pipe", "--regex", "proj-.*+sci.*")
+	assert.Equal(t, "c.md\n\n", out)
+}
+
+func TestCheckPatterns(t *testing.T) {
+	err := CheckPatterns(ParseQuery("foo,re:proj-("))
+	assert.ErrorContains(t, err, `bad regex in query tag "re:proj-("`)
+	err = CheckPatterns(ParseQuery("foo!re:[a"))
+	assert.Error(t, err)
+	// a wildcard is never a bad pattern:
+	assert.NoError(t, CheckPatterns(ParseQuery("f(*")))
+}
+
+func TestQuiet(t *testing.T) {
+	// 06.quz.md has no date line that parses:
+	out, errs := runMain(t, "--glob", TEST_PATTERN, "--pipe", "diff")
+	assert.Equal(t, "05.quz.md\n\n", out)
+	assert.Contains(t, errs, "warning: failed to parse a date in 1 files")
+
+	out, errs = runMain(t, "--glob", TEST_PATTERN, "--pipe", "--quiet", "diff")
+	assert.Equal(t, "05.quz.md\n\n", out)
+	assert.Empty(t, errs)
+}
+
+func TestPrintLimit(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("sot,science")
+	collection := Collect(entries, Tagmap(entries), queries)
+
+	var buf bytes.Buffer
+	Print(&buf, entries, collection, queries, PrintOptions{sort: "date-desc", limit: 2})
+	assert.True(t, strings.HasPrefix(buf.String(), "[files]\n04.baz.md\n01.foo.md\n\n"))
+	assert.Contains(t, buf.String(), "[sums]\nfiles       = 4\nshown       = 2\nadjacencies = 3\n")
+
+	// a limit beyond the matches shows them all, and says nothing more:
+	buf.Reset()
+	Print(&buf, entries, collection, queries, PrintOptions{limit: 10})
+	assert.True(t, strings.HasPrefix(buf.String(), "[files]\n01.foo.md\n02.foo.md\n03.bar.md\n04.baz.md\n\n"))
+	assert.NotContains(t, buf.String(), "shown")
+
+	buf.Reset()
+	Print(&buf, entries, collection, queries, PrintOptions{pipe: true, limit: 1})
+	assert.Equal(t, "01.foo.md\n\n", buf.String())
+}
+
+func TestOutput(t *testing.T) {
+	stdout, _ := runMain(t, "--glob", TEST_PATTERN, "science")
+
+	path := filepath.Join(t.TempDir(), "out.toml")
+	os.WriteFile(path, []byte("replaced"), 0644)
+	out, _ := runMain(t, "--glob", TEST_PATTERN, "--output", path, "science")
+	assert.Empty(t, out)
+	written, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, stdout, string(written))
+}
+
+func TestPrintNul(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("science")
+	collection := Collect(entries, Tagmap(entries), queries)
+
+	var buf bytes.Buffer
+	Print(&buf, entries, collection, queries, PrintOptions{pipe: true, print0: true})
+	assert.Equal(t, "02.foo.md\x0003.bar.md\x0004.baz.md\x00", buf.String())
+	assert.NotContains(t, buf.String(), "\n")
+
+	// and --print0 alone implies --pipe:
+	out, _ := runMain(t, "--glob", TEST_PATTERN, "--print0", "science")
+	assert.Equal(t, buf.String(), out)
+}
+
+func TestVerbose(t *testing.T) {
+	// every section, whatever --pipe says:
+	out, _ := runMain(t, "--glob", TEST_PATTERN, "--pipe", "--verbose", "diff")
+	expected, _ := runMain(t, "--glob", TEST_PATTERN, "diff")
+	assert.Equal(t, expected, out)
+	assert.Contains(t, out, "[sums]")
+}
+
+func TestProcessQueriesLeavesTagmap(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	tagmap := Tagmap(entries)
+	before := CloneTagmap(tagmap)
+
+	for _, query := range []string{"sot,science", "sot+science", "science+-foo", "s*,diff!foo", "-sot"} {
+		queries := ParseQuery(query)
+		first := ProcessQueries(entries, tagmap, queries)
+		second := ProcessQueries(entries, tagmap, queries)
+		assert.Equal(t, first, second, query)
+		assert.Equal(t, before, tagmap, query)
+	}
+}
+
+func TestProcessQueriesAnd(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	tagmap := Tagmap(entries)
+
+	files := ProcessQueries(entries, tagmap, ParseQuery("sot+science"))
+	expected := Set{"02.foo.md": true, "03.bar.md": true}
+	assert.Equal(t, expected, files)
+}
+
+func TestParseQuery(t *testing.T) {
+	expected := Query{[]string{"foo"}, [][]string{{"foo"}}, [][]string{{}}}
+	assert.Equal(t, expected, ParseQuery("foo"))
+	expected = Query{[]string{"foo", "bar"}, [][]string{{"foo"}, {"bar"}}, [][]string{{}, {}}}
+	assert.Equal(t, expected, ParseQuery("foo,bar"))
+	expected = Query{[]string{"foo", "bar"}, [][]string{{"foo", "bar"}}, [][]string{{}}}
+	assert.Equal(t, expected, ParseQuery("foo+bar"))
+
+	expected = Query{[]string{"foo", "bar", "baz"}, [][]string{{"foo", "bar"}, {"baz"}}, [][]string{{}, {}}}
+	assert.Equal(t, expected, ParseQuery("foo+bar,baz"))
+
+	expected = Query{[]string{"science"}, [][]string{{"science"}, {}}, [][]string{{"foo"}, {"bar"}}}
+	assert.Equal(t, expected, ParseQuery("science+-foo,-bar"))
+}
+
+func TestProcessQueriesMixed(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	tagmap := Tagmap(entries)
+
+	// (foo AND science) matches nothing, leaving only diff:
+	files := ProcessQueries(entries, tagmap, ParseQuery("foo+science,diff"))
+	assert.Equal(t, Set{"05.quz.md": true}, files)
+
+	files = ProcessQueries(entries, tagmap, ParseQuery("sot+science,foo"))
+	expected := Set{"01.foo.md": true, "02.foo.md": true, "03.bar.md": true}
+	assert.Equal(t, expected, files)
+}
+
+func TestProcessQueriesNegated(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	tagmap := Tagmap(entries)
+
+	files := ProcessQueries(entries, tagmap, ParseQuery("sot+-foo"))
+	assert.Equal(t, Set{"02.foo.md": true, "03.bar.md": true}, files)
+
+	// a bare negation matches every other entry, untagged ones included:
+	files = ProcessQueries(entries, tagmap, ParseQuery("-sot"))
+	expected := Set{"04.baz.md": true, "05.quz.md": true, "06.quz.md": true}
+	assert.Equal(t, expected, files)
+
+	files = ProcessQueries(entries, tagmap, ParseQuery("-sot+-science,foo"))
+	expected = Set{"01.foo.md": true, "05.quz.md": true, "06.quz.md": true}
+	assert.Equal(t, expected, files)
+}
+
+func TestProcessQueriesNot(t *testing.T) {
+	entries := []Entry{
+		{filename: "a.md", tags: []string{"a", "b"}},
+		{filename: "b.md", tags: []string{"a", "b", "c"}},
+		{filename: "c.md", tags: []string{"a", "c"}},
+		{filename: "d.md", tags: []string{"d"}},
+	}
+	tagmap := Tagmap(entries)
+
+	assert.Equal(t, Set{"a.md": true}, ProcessQueries(entries, tagmap, ParseQuery("a+b!c")))
+	// subtracted from every OR group:
+	assert.Equal(t, Set{"a.md": true, "d.md": true}, ProcessQueries(entries, tagmap, ParseQuery("a,d!c")))
+	assert.Equal(t, Set{"d.md": true}, ProcessQueries(entries, tagmap, ParseQuery("a,d!c!b")))
+	assert.Equal(t, Set{"a.md": true, "d.md": true}, ProcessQueries(entries, tagmap, ParseQuery("!c")))
+
+	expected := Query{[]string{"a", "b"}, [][]string{{"a", "b"}}, [][]string{{"c"}}}
+	assert.Equal(t, expected, ParseQuery("a+b!c"))
+
+	// every tag after ! is subtracted, however they're joined:
+	expected = Query{[]string{"a"}, [][]string{{"a"}}, [][]string{{"b", "c"}}}
+	assert.Equal(t, expected, ParseQuery("a!b,c"))
+	assert.Equal(t, expected, ParseQuery("a!b+c"))
+	assert.Equal(t, expected, ParseQuery("a!b!c"))
+	assert.Equal(t, Set{}, ProcessQueries(entries, tagmap, ParseQuery("a!b,c")))
+	assert.Equal(t, Set{"d.md": true}, ProcessQueries(entries, tagmap, ParseQuery("d,a!b,c")))
+
+	out, _ := runMain(t, "--glob", TEST_PATTERN, "--pipe", "sot!foo,science")
+	assert.Equal(t, "\n", out)
+	out, _ = runMain(t, "--glob", TEST_PATTERN, "--pipe", "sot,diff!foo+science")
+	assert.Equal(t, "05.quz.md\n\n", out)
+}
+
+func TestSharedWeights(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	tagmap := Tagmap(entries)
+	queries := ParseQuery("foo,science")
+
+	// sot is on one file with foo and two with science:
+	files := ProcessQueries(entries, tagmap, queries)
+	adjacencies := ReduceAdjacencies(entries, tagmap, files, queries)
+	assert.Equal(t, Set{"sot": true}, adjacencies)
+	assert.Equal(t, map[string]int{"sot": 3}, SharedWeights(entries, files, adjacencies))
+
+	// inverted, the weights are those of the files listed, not of science:
+	files = Invert(entries, ProcessQueries(entries, tagmap, ParseQuery("science")))
+	adjacencies = ReduceAdjacencies(entries, tagmap, files, Query{})
+	expected := map[string]int{"sot": 1, "foo": 1, "diff": 1}
+	assert.Equal(t, expected, SharedWeights(entries, files, adjacencies))
+}
+
+func TestCommonAdjacencies(t *testing.T) {
+	entries := []Entry{
+		{filename: "a.md", tags: []string{"foo", "bar", "baz"}},
+		{filename: "b.md", tags: []string{"foo", "qux"}},
+		{filename: "c.md", tags: []string{"bar", "qux"}},
+		{filename: "d.md", tags: []string{"bar", "quz"}},
+	}
+	tagmap, adjacencies := Tagmap(entries), Adjacencies(entries)
+	queries := ParseQuery("foo+bar")
+
+	// only the one file carrying both, where quz is only adjacent to bar:
+	files := ProcessQueries(entries, tagmap, queries)
+	expected := Set{"foo": true, "bar": true, "baz": true}
+	assert.Equal(t, expected, ReduceAdjacencies(entries, tagmap, files, queries))
+
+	expected = Set{"baz": true, "qux": true}
+	assert.Equal(t, expected, CommonAdjacencies(adjacencies, queries))
+}
+
+func TestSuperset(t *testing.T) {
+	entries := []Entry{
+		{filename: "a.md", tags: []string{"x", "y", "z"}},
+		{filename: "b.md", tags: []string{"y", "x"}},
+		{filename: "c.md", tags: []string{"w", "x", "y"}},
+		{filename: "d.md", tags: []string{"x"}},
+		{filename: "e.md", tags: []string{"y"}},
+	}
+	// a and b share x and y, which c also carries:
+	files := Superset(entries, Set{"a.md": true, "b.md": true})
+	expected := Set{"a.md": true, "b.md": true, "c.md": true}
+	assert.Equal(t, expected, files)
+
+	// d and e share nothing:
+	files = Superset(entries, Set{"d.md": true, "e.md": true})
+	assert.Empty(t, files)
+}
+
+func TestReadEntriesEncoding(t *testing.T) {
+	files, err := Filelist("./mock/latin1/*.md")
+	assert.NoError(t, err)
+	enc, err := ParseEncoding("latin1")
+	assert.NoError(t, err)
+
+	entries, err := ReadEntries(files, ReadOptions{encoding: enc})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"café", "naïve"}, entries[0].tags)
+	assert.Equal(t, "Über alles.\n", ParseBody(&entries[0].content))
+
+	// read as UTF-8, the accented bytes are mangled:
+	entries, err = ReadEntries(files, ReadOptions{})
+	assert.NoError(t, err)
+	assert.NotEqual(t, []string{"café", "naïve"}, entries[0].tags)
+}
+
+func TestOrphans(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	tagmap := Tagmap(entries)
+
+	for query, expected := range map[string]Set{
+		"science":      {"04.baz.md": true},
+		"diff":         {"05.quz.md": true},
+		"sot":          {},
+		"science,diff": {"04.baz.md": true, "05.quz.md": true},
+	} {
+		queries := ParseQuery(query)
+		files := ProcessQueries(entries, tagmap, queries)
+		assert.Equal(t, expected, Orphans(entries, tagmap, files, queries), query)
+	}
+}
+
+func TestResolveQueryEnv(t *testing.T) {
+	t.Setenv(QUERY_ENV, "science")
+	assert.Equal(t, "science", ResolveQuery("", []string{}))
+
+	// explicit args override the environment:
+	assert.Equal(t, "sot", ResolveQuery("", []string{"sot"}))
+	assert.Equal(t, "foo", ResolveQuery("foo", []string{"sot"}))
+
+	t.Setenv(QUERY_ENV, "")
+	assert.Equal(t, "", ResolveQuery("", []string{}))
+}
+
+func TestPrint(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("science")
+	collection := Collect(entries, Tagmap(entries), queries)
+
+	var buf bytes.Buffer
+	Print(&buf, entries, collection, queries, PrintOptions{})
+	expected := `[files]
+02.foo.md
+03.bar.md
+04.baz.md
+
+[tags]
+science
+
+[adjacencies]
+sot
+
+[sums]
+files       = 3
+adjacencies = 1
+words       = 4
+
+`
+	assert.Equal(t, expected, buf.String())
+
+	// inverted, the neighbors of the files left, rather than of science:
+	collection, err := Filter(entries, Tagmap(entries), Adjacencies(entries), queries, SearchOptions{invert: true})
+	assert.NoError(t, err)
+	buf.Reset()
+	Print(&buf, entries, collection, queries, PrintOptions{})
+	expected = `[files]
+01.foo.md
+05.quz.md
+06.quz.md
+
+[tags]
+science
+
+[adjacencies]
+diff
+foo
+sot
+
+[sums]
+files       = 3
+adjacencies = 3
+words       = 4
+
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestPrintOrdersAdjacencies(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("sot")
+	collection := Collect(entries, Tagmap(entries), queries)
+
+	// science shares two of the files, foo only one:
+	var buf bytes.Buffer
+	Print(&buf, entries, collection, queries, PrintOptions{})
+	assert.Contains(t, buf.String(), "[adjacencies]\nscience\nfoo\n\n")
+}
+
+func TestPrintWeights(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	tagmap := Tagmap(entries)
+	queries := ParseQuery("sot,science")
+	collection := Collect(entries, tagmap, queries)
+
+	var buf bytes.Buffer
+	opts := PrintOptions{weights: SharedWeights(entries, collection["files"], collection["adjacencies"])}
+	Print(&buf, entries, collection, queries, opts)
+	expected := `[adjacencies]
+science = 3
+sot     = 3
+foo     = 1
+`
+	assert.Contains(t, buf.String(), expected)
+}
+
+func TestPrintAligned(t *testing.T) {
+	collection := map[string]Set{
+		"files":       Set{"a.md": true},
+		"adjacencies": Set{"foo": true, "bar": true},
+	}
+	opts := PrintOptions{weights: map[string]int{"foo": 120, "bar": 7}}
+
+	var buf bytes.Buffer
+	Print(&buf, nil, collection, ParseQuery("baz"), opts)
+	expected := `[adjacencies]
+foo = 120
+bar =   7
+
+[sums]
+files       =   1
+adjacencies =   2
+`
+	assert.Contains(t, buf.String(), expected)
+}
+
+func TestHierarchy(t *testing.T) {
+	entries := []Entry{
+		{filename: "a.md", tags: []string{"science/biology", "foo"}},
+		{filename: "b.md", tags: []string{"science/physics/quantum"}},
+		{filename: "c.md", tags: []string{"science"}},
+		{filename: "d.md", tags: []string{"sciences"}},
+	}
+	tagmap, adjacencies := Tagmap(entries), Adjacencies(entries)
+	queries := ParseQuery("science")
+
+	// exact matches only without the hierarchy:
+	assert.Equal(t, Set{"c.md": true}, ProcessQueries(entries, tagmap, queries))
+
+	rolled, neighbors := Hierarchy(tagmap, adjacencies)
+	expected := Set{"a.md": true, "b.md": true, "c.md": true}
+	assert.Equal(t, expected, ProcessQueries(entries, rolled, queries))
+	assert.Equal(t, Set{"b.md": true}, rolled["science/physics"])
+
+	// the concrete subtags, not the levels between:
+	expected = Set{"science/biology": true, "science/physics/quantum": true, "foo": true}
+	files := ProcessQueries(entries, rolled, queries)
+	assert.Equal(t, expected, ReduceAdjacencies(entries, rolled, files, queries))
+	assert.NotEmpty(t, neighbors["science"])
+	// the originals are untouched:
+	assert.NotContains(t, tagmap, "science/physics")
+	assert.Empty(t, adjacencies["science"])
+}
+
+func TestCloneTagmap(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	tagmap := Tagmap(entries)
+	queries := ParseQuery("science")
+
+	Diff(entries, CloneTagmap(tagmap), queries)
+	assert.Len(t, tagmap["science"], 3)
+}
+
+func TestResultTags(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	files := ProcessQueries(entries, Tagmap(entries), ParseQuery("science,diff"))
+
+	// foo is only on 01.foo.md, which doesn't match:
+	expected := []string{"diff", "science", "sot"}
+	assert.Equal(t, expected, ResultTags(entries, files))
+	assert.Empty(t, ResultTags(entries, Set{}))
+}
+
+func TestTagsOnly(t *testing.T) {
+	out, _ := runMain(t, "--glob", TEST_PATTERN, "--tags-only", "science,diff")
+	assert.Equal(t, "diff\nscience\nsot\n", out)
+
+	// only 04.baz.md and 05.quz.md are dated in October:
+	out, _ = runMain(t, "--glob", TEST_PATTERN, "--tags-only", "--date", "2024.10", "science,diff")
+	assert.Equal(t, "diff\nscience\n", out)
+}
+
+func TestInvert(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	files := ProcessQueries(entries, Tagmap(entries), ParseQuery("sot,science"))
+
+	// including the untagged file:
+	expected := Set{"05.quz.md": true, "06.quz.md": true}
+	assert.Equal(t, expected, Invert(entries, files))
+}
+
+func TestInvertQueries(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	tagmap := Tagmap(entries)
+
+	cases := map[string]Set{
+		"foo":         {"02.foo.md": true, "03.bar.md": true, "04.baz.md": true, "05.quz.md": true, "06.quz.md": true},
+		"sot+science": {"01.foo.md": true, "04.baz.md": true, "05.quz.md": true, "06.quz.md": true},
+		"foo,diff":    {"02.foo.md": true, "03.bar.md": true, "04.baz.md": true, "06.quz.md": true},
+		// nothing matches, so everything is inverted:
+		"qaz": {"01.foo.md": true, "02.foo.md": true, "03.bar.md": true, "04.baz.md": true, "05.quz.md": true, "06.quz.md": true},
+	}
+	for query, expected := range cases {
+		collection := Collect(entries, tagmap, ParseQuery(query))
+		assert.Equal(t, expected, Invert(entries, collection["files"]), query)
+	}
+
+	// the neighbors of the files left, whether or not the query tags are among
+	// the keys of the adjacencies:
+	adjacencies := map[string]Set{}
+	neighbors := map[string]Set{
+		"foo":         {"sot": true, "science": true, "diff": true},
+		"sot+science": {"sot": true, "foo": true, "science": true, "diff": true},
+		"foo,diff":    {"sot": true, "science": true},
+		"qaz":         {"sot": true, "foo": true, "science": true, "diff": true},
+	}
+	for query, expected := range neighbors {
+		collection, err := Filter(entries, tagmap, adjacencies, ParseQuery(query), SearchOptions{invert: true})
+		assert.NoError(t, err)
+		assert.Equal(t, cases[query], collection["files"], query)
+		assert.Equal(t, expected, collection["adjacencies"], query)
+	}
+}
+
+func TestReduceAdjacenciesMissing(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	tagmap := Tagmap(entries)
+
+	// diff is only ever alone, and qaz nowhere:
+	assert.Equal(t, Set{}, Collect(entries, tagmap, ParseQuery("diff"))["adjacencies"])
+	assert.Equal(t, Set{}, Collect(entries, tagmap, ParseQuery("qaz"))["adjacencies"])
+	assert.Equal(t, Set{"sot": true}, Collect(entries, tagmap, ParseQuery("qaz,foo"))["adjacencies"])
+	// after a grep, the tags of the files found in the content, though no file
+	// carries bar itself:
+	tagmap = Grep(entries, Tagmap(entries), ParseQuery("bar"))
+	assert.Contains(t, tagmap, "bar")
+	expected := Set{"sot": true, "foo": true, "science": true}
+	assert.Equal(t, expected, Collect(entries, tagmap, ParseQuery("bar"))["adjacencies"])
+}
+
+func TestReduceAdjacenciesResult(t *testing.T) {
+	entries := []Entry{
+		{filename: "a.md", tags: []string{"foo", "sot"}},
+		{filename: "b.md", tags: []string{"bar", "science"}},
+		{filename: "c.md", tags: []string{"foo", "diff"}},
+	}
+	tagmap := Tagmap(entries)
+
+	// the neighbors of the files matched by either branch, and not diff, which
+	// shares a file with foo but not with sot:
+	collection := Collect(entries, tagmap, ParseQuery("foo+sot,bar"))
+	assert.Equal(t, Set{"a.md": true, "b.md": true}, collection["files"])
+	assert.Equal(t, Set{"foo": true, "sot": true, "science": true}, collection["adjacencies"])
+	// nor a query tag alone in its files:
+	collection = Collect(entries, tagmap, ParseQuery("foo"))
+	assert.Equal(t, Set{"sot": true, "diff": true}, collection["adjacencies"])
+
+	// inverted, the neighbors of the files kept rather than those of the query:
+	collection, err := Filter(entries, tagmap, Adjacencies(entries), ParseQuery("bar"), SearchOptions{invert: true})
+	assert.NoError(t, err)
+	assert.Equal(t, Set{"a.md": true, "c.md": true}, collection["files"])
+	assert.Equal(t, Set{"foo": true, "sot": true, "diff": true}, collection["adjacencies"])
+}
+
+func TestSortFilesTiebreak(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i, name := range []string{"a.md", "b.md", "c.md"} {
+		date := "2024.09.25"
+		if name == "a.md" {
+			date = "2024.09.26"
+		}
+		f := filepath.Join(dir, name)
+		os.WriteFile(f, []byte("# "+name+"\n: "+date+"\n+ foo\n"), 0644)
+		// c is the newer of the two sharing a date:
+		mtime := now.Add(time.Duration(i) * time.Hour)
+		os.Chtimes(f, mtime, mtime)
+	}
+	entries, err := Entries(filepath.Join(dir, "*.md"))
+	assert.NoError(t, err)
+	files := ProcessQueries(entries, Tagmap(entries), ParseQuery("foo"))
+
+	assert.Equal(t, []string{"a.md", "b.md", "c.md"}, SortFiles(entries, files, "name", "name"))
+	assert.Equal(t, []string{"b.md", "c.md", "a.md"}, SortFiles(entries, files, "date", "name"))
+	assert.Equal(t, []string{"c.md", "b.md", "a.md"}, SortFiles(entries, files, "date", "mtime"))
+	// ties are broken the same way either way round:
+	assert.Equal(t, []string{"a.md", "b.md", "c.md"}, SortFiles(entries, files, "date-desc", "name"))
+	assert.Equal(t, []string{"a.md", "c.md", "b.md"}, SortFiles(entries, files, "date-desc", "mtime"))
+}
+
+func TestSortFilesDate(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	files := ProcessQueries(entries, Tagmap(entries), ParseQuery("science,diff"))
+
+	expected := []string{"02.foo.md", "03.bar.md", "04.baz.md", "05.quz.md"}
+	assert.Equal(t, expected, SortFiles(entries, files, "date", "name"))
+	expected = []string{"04.baz.md", "05.quz.md", "02.foo.md", "03.bar.md"}
+	assert.Equal(t, expected, SortFiles(entries, files, "date-desc", "name"))
+}
+
+func TestSortPriority(t *testing.T) {
+	entries := mockEntries(t, "./mock/priority/*.md")
+	tagmap := Tagmap(entries)
+	// matched by the plain name, with or without the marker:
+	assert.Equal(t, []string{"science", "sot"}, entries[1].tags)
+	assert.Equal(t, Set{"science": true}, entries[1].primary)
+	assert.Len(t, tagmap["science"], 3)
+
+	files := ProcessQueries(entries, tagmap, ParseQuery("science"))
+	ordered := OrderFiles(entries, files, PrintOptions{sort: "priority", primary: Set{"science": true}})
+	assert.Equal(t, []string{"02.core.md", "01.aside.md", "03.other.md"}, ordered)
+	ordered = OrderFiles(entries, files, PrintOptions{sort: "priority", primary: Set{"sot": true}})
+	assert.Equal(t, []string{"03.other.md", "01.aside.md", "02.core.md"}, ordered)
+
+	out, _ := runMain(t, "--glob", "mock/priority/*.md", "--pipe", "--sort", "priority", "sot")
+	assert.Equal(t, "03.other.md\n01.aside.md\n02.core.md\n\n", out)
+
+	header := "# a.md\n+ foo!\n+ !\n"
+	tags, primary := ParseTags(&header, "")
+	assert.Equal(t, []string{"foo", "!"}, tags)
+	assert.Equal(t, Set{"foo": true}, primary)
+}
+
+func TestWordCount(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	// "Foo.", "Bar." and "Blah. Foo.", leaving out the headers:
+	files := ProcessQueries(entries, Tagmap(entries), ParseQuery("science"))
+	assert.Equal(t, 4, WordCount(entries, files))
+	assert.Equal(t, 0, WordCount(entries, Set{}))
+
+	content := "---\ndate: 2024-09-25\ntags: [foo]\n---\nthree more words"
+	e, err := ParseContent("front.md", &content, ReadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, WordCount([]Entry{e}, Set{"front.md": true}))
+}
+
+func TestPrintHistogram(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("science,diff,-sot")
+	collection := Collect(entries, Tagmap(entries), queries)
+
+	var buf bytes.Buffer
+	Print(&buf, entries, collection, queries, PrintOptions{histogram: true})
+	// 06.quz.md has no date that parses:
+	expected := `[months]
+2024.09 = 2
+2024.10 = 2
+unknown = 1
+
+[sums]
+`
+	assert.Contains(t, buf.String(), expected)
+
+	buf.Reset()
+	Print(&buf, entries, collection, queries, PrintOptions{})
+	assert.NotContains(t, buf.String(), "[months]")
+}
+
+func TestPrintGroups(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("sot,science")
+	tagmap := Tagmap(entries)
+	adjacencies := Adjacencies(entries)
+	collection := Collect(entries, tagmap, queries)
+
+	var buf bytes.Buffer
+	opts := PrintOptions{groups: GroupAdjacencies(tagmap, adjacencies, queries)}
+	Print(&buf, entries, collection, queries, opts)
+	expected := `[files]
+01.foo.md
+02.foo.md
+03.bar.md
+04.baz.md
+
+[tags]
+sot
+science
+
+[adjacencies.sot]
+science = 2
+foo     = 1
+
+[adjacencies.science]
+sot = 2
+
+[sums]
+files       = 4
+adjacencies = 3
+words       = 6
+
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestScanLines(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "long.md")
+	long := "# long.md\n: 2024.09.25\n+ foo\n\n"
+	for i := range 1000 {
+		if i == 900 {
+			long += "a needle in the haystack\n"
+		} else {
+			long += "hay\n"
+		}
+	}
+	os.WriteFile(f, []byte(long), 0644)
+	queries := ParseQuery("needle")
+
+	entries, err := ReadEntries([]string{f}, ReadOptions{})
+	assert.NoError(t, err)
+	tagmap := Grep(entries, Tagmap(entries), queries)
+	assert.Equal(t, Set{"long.md": true}, tagmap["needle"])
+
+	entries, err = ReadEntries([]string{f}, ReadOptions{lines: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, "# long.md\n: 2024.09.25\n+ foo\n\nhay\nhay\nhay\nhay\nhay\nhay\n", entries[0].content)
+	assert.Equal(t, []string{"foo"}, entries[0].tags)
+	tagmap = Grep(entries, Tagmap(entries), queries)
+	assert.Empty(t, tagmap["needle"])
+}
+
+func TestLazyContent(t *testing.T) {
+	opts := ReadOptions{headers: true}
+	paths, err := Filelist(TEST_PATTERN)
+	assert.NoError(t, err)
+	entries, err := ReadEntries(paths, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "# 01.foo.md\n: 2024.09.25\n+ sot\n+ foo\n\n", entries[0].content)
+	assert.Equal(t, []string{"sot", "foo"}, entries[0].tags)
+
+	tagmap := Tagmap(entries)
+	assert.Equal(t, Tagmap(mockEntries(t, TEST_PATTERN)), tagmap)
+
+	files := ProcessQueries(entries, tagmap, ParseQuery("foo"))
+	loaded, err := LoadContent(entries, files, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "# 01.foo.md\n: 2024.09.25\n+ sot\n+ foo\n\nFoo bar.\n", loaded[0].content)
+	// the rest keep only their headers, and the originals are untouched:
+	assert.Equal(t, "# 02.foo.md\n: 2024.09.25\n+ sot\n+ science\n\n", loaded[1].content)
+	assert.Equal(t, entries[1], loaded[1])
+	assert.NotEqual(t, entries[0], loaded[0])
+}
+
+func TestReadEntriesMissing(t *testing.T) {
+	entries, err := ReadEntries([]string{"mock/01.foo.md", "mock/missing.md"}, ReadOptions{})
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Nil(t, entries)
+}
+
+func TestLoadContentErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "note.md")
+	os.WriteFile(path, []byte("# note.md\n: 2024.09.25\n+ foo\n\nBody.\n"), 0644)
+	opts := ReadOptions{headers: true}
+	entries, err := ReadEntries([]string{path}, opts)
+	assert.NoError(t, err)
+
+	// gone between reading the headers and the content:
+	os.Remove(path)
+	loaded, err := LoadContent(entries, Set{"note.md": true}, opts)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Nil(t, loaded)
+	// but only the matched files are read:
+	_, err = LoadContent(entries, Set{}, opts)
+	assert.NoError(t, err)
+}
+
+func TestReadHeaderFrontMatter(t *testing.T) {
+	dat, err := ReadHeader("./mock/frontmatter/02.block.md")
+	assert.NoError(t, err)
+	assert.Equal(t, "---\ndate: 2024-10-09\ntags:\n  - sot\n  - foo\n---\n", string(dat))
+}
+
+func TestMaxFileSize(t *testing.T) {
+	dir := t.TempDir()
+	small := filepath.Join(dir, "small.md")
+	huge := filepath.Join(dir, "huge.md")
+	os.WriteFile(small, []byte("# small.md\n: 2024.09.25\n+ foo\n"), 0644)
+	os.WriteFile(huge, []byte("# huge.md\n: 2024.09.25\n+ foo\n\n"+strings.Repeat("data\n", 1000)), 0644)
+
+	var stderr bytes.Buffer
+	warnings = &stderr
+	defer func() { warnings = os.Stderr }()
+
+	entries, err := ReadEntries([]string{huge, small}, ReadOptions{maxsize: 100})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "small.md", entries[0].filename)
+	assert.Contains(t, stderr.String(), "warning: skipping "+huge)
+
+	stderr.Reset()
+	entries, err = ReadEntries([]string{huge, small}, ReadOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Empty(t, stderr.String())
+}
+
+func TestSprintTagSummary(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	expected := `[tags]
+science = 3
+sot     = 3
+diff    = 1
+foo     = 1
+`
+	assert.Equal(t, expected, SprintTagSummary(Tagmap(entries)))
+	assert.Equal(t, "[tags]\n", SprintTagSummary(map[string]Set{}))
+
+	// to --output, like the results of a query:
+	path := filepath.Join(t.TempDir(), "summary.toml")
+	out, _ := runMain(t, "--glob", TEST_PATTERN, "--output", path)
+	assert.Empty(t, out)
+	written, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(written))
+}
+
+func TestCount(t *testing.T) {
+	out, _ := runMain(t, "--count", "--glob", TEST_PATTERN, "science")
+	assert.Equal(t, "3\n", out)
+
+	// composes with the filters:
+	out, _ = runMain(t, "--count", "--date", "2024.10", "--glob", TEST_PATTERN, "science")
+	assert.Equal(t, "1\n", out)
+	out, _ = runMain(t, "--count", "--invert", "--glob", TEST_PATTERN, "science")
+	assert.Equal(t, "3\n", out)
+}
+
+func TestDuplicateTags(t *testing.T) {
+	entries := mockEntries(t, "./mock/duplicate/*.md")
+	assert.Equal(t, []string{"foo", "bar"}, entries[0].tags)
+	assert.Equal(t, map[string]int{"foo": 1}, entries[0].repeats)
+	assert.Nil(t, entries[1].repeats)
+
+	// no self-edge:
+	adjacencies := Adjacencies(entries)
+	assert.Equal(t, Set{"bar": true}, adjacencies["foo"])
+	assert.Equal(t, Set{"foo": true}, adjacencies["bar"])
+
+	// while the repeat is still counted as an occurrence:
+	assert.Equal(t, map[string]int{"foo": 3, "bar": 1}, TagCounts(entries))
+}
+
+func TestRawCounts(t *testing.T) {
+	entries := []Entry{
+		{filename: "a.md", tags: []string{"foo", "bar", "foo"}},
+		{filename: "b.md", tags: []string{"foo"}},
+		{filename: "c.md", tags: []string{"bar"}},
+	}
+	tagmap := Tagmap(entries)
+	raw := TagCounts(entries)
+	assert.Equal(t, map[string]int{"foo": 3, "bar": 2}, raw)
+	assert.Len(t, tagmap["foo"], 2)
+
+	var buf bytes.Buffer
+	PrintTopTags(&buf, tagmap, raw, 5)
+	expected := `[top-tags]
+foo = { occurrences = 3, files = 2 }
+bar = { occurrences = 2, files = 2 }
+
+`
+	assert.Equal(t, expected, buf.String())
+
+	buf.Reset()
+	PrintTopTags(&buf, tagmap, nil, 1)
+	assert.Equal(t, "[top-tags]\nbar = 2\n\n", buf.String())
+}
+
+func TestReadQuery(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	tagmap := Tagmap(entries)
+	path := filepath.Join(t.TempDir(), "profile")
+
+	os.WriteFile(path, []byte("# my profile\nsot\n\nscience\n"), 0644)
+	query, err := ReadQuery(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "sot+science", query)
+	expected := Set{"02.foo.md": true, "03.bar.md": true}
+	assert.Equal(t, expected, ProcessQueries(entries, tagmap, ParseQuery(query)))
+
+	// a single line is a query expression of its own:
+	os.WriteFile(path, []byte("foo,diff\n"), 0644)
+	query, err = ReadQuery(path)
+	assert.NoError(t, err)
+	expected = Set{"01.foo.md": true, "05.quz.md": true}
+	assert.Equal(t, expected, ProcessQueries(entries, tagmap, ParseQuery(query)))
+}
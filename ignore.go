@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// like .gitignore, lists patterns of files to leave out. read from the root of
+// the glob.
+const IGNORE_FILE = ".gagignore"
+
+// a single line of an ignore file.
+type IgnoreRule struct {
+	pattern string
+	// a leading ! re-includes what an earlier rule ignored.
+	negate bool
+	// a trailing / only matches directories.
+	dir bool
+}
+
+// parses the lines of an ignore file, skipping blanks and # comments.
+func ParseIgnore(content string) (rules []IgnoreRule) {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := IgnoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dir = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		rule.pattern = strings.TrimPrefix(line, "/")
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// whether the rule matches a path relative to the ignore file. a pattern with a
+// slash is matched against the leading parts of the path, otherwise against any
+// single part of it, so that a bare name ignores a file or directory anywhere.
+func (r IgnoreRule) Match(rel string) bool {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	// directory rules can't match the file itself, the last part:
+	last := len(parts)
+	if r.dir {
+		last--
+	}
+	for i := 0; i < last; i++ {
+		var name string
+		if strings.Contains(r.pattern, "/") {
+			name = strings.Join(parts[:i+1], "/")
+		} else {
+			name = parts[i]
+		}
+		if ok, _ := filepath.Match(r.pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// whether the path is ignored. the last matching rule wins.
+func Ignored(rules []IgnoreRule, rel string) (ignored bool) {
+	for _, r := range rules {
+		if r.Match(rel) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// the leading directories of a glob pattern before any wildcard.
+func GlobRoot(pattern string) string {
+	parts := strings.Split(filepath.ToSlash(filepath.Dir(pattern)), "/")
+	root := []string{}
+	for _, p := range parts {
+		if strings.ContainsAny(p, `*?[\`) {
+			break
+		}
+		root = append(root, p)
+	}
+	if len(root) == 0 {
+		return "."
+	}
+	return filepath.FromSlash(strings.Join(root, "/"))
+}
+
+// the deepest directory holding the roots of all the glob patterns, so that
+// notes/a/*.md and notes/b/*.md share notes.
+func CommonRoot(patterns []string) string {
+	var common []string
+	for i, pattern := range patterns {
+		parts := strings.Split(filepath.ToSlash(filepath.Clean(GlobRoot(pattern))), "/")
+		if i == 0 {
+			common = parts
+			continue
+		}
+		n := 0
+		for n < len(common) && n < len(parts) && common[n] == parts[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	switch {
+	case len(common) == 0:
+		return "."
+	case len(common) == 1 && common[0] == "":
+		// only the leading slash of absolute patterns is shared:
+		return string(filepath.Separator)
+	}
+	return filepath.FromSlash(strings.Join(common, "/"))
+}
+
+// the files matching the glob pattern, less those ignored by an ignore file in
+// the root of the pattern.
+func Filelist(pattern string) ([]string, error) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("bad glob %q: %w", pattern, err)
+	}
+	root := GlobRoot(pattern)
+	dat, err := os.ReadFile(filepath.Join(root, IGNORE_FILE))
+	if errors.Is(err, fs.ErrNotExist) {
+		// no ignore file, nothing to ignore:
+		return files, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rules := ParseIgnore(string(dat))
+
+	filtered := []string{}
+	for _, f := range files {
+		rel, err := filepath.Rel(root, f)
+		if err != nil || !Ignored(rules, rel) {
+			filtered = append(filtered, f)
+		}
+	}
+	return filtered, nil
+}
+
+// the Filelist of each pattern in turn, without repeating a file matched by more
+// than one.
+func Filelists(patterns []string) ([]string, error) {
+	seen := Set{}
+	files := []string{}
+	for _, pattern := range patterns {
+		list, err := Filelist(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range list {
+			if clean := filepath.Clean(f); !seen[clean] {
+				seen[clean] = true
+				files = append(files, f)
+			}
+		}
+	}
+	return files, nil
+}
+
+// the files less those matching any of the patterns. the patterns are globbed
+// too, so ./notes/*.md excludes notes/a.md however either path is written.
+func Exclude(files []string, patterns []string) ([]string, error) {
+	excluded, err := Filelists(patterns)
+	if err != nil {
+		return nil, err
+	}
+	drop := Set{}
+	for _, f := range excluded {
+		drop[filepath.Clean(f)] = true
+	}
+	kept := []string{}
+	for _, f := range files {
+		if !drop[filepath.Clean(f)] {
+			kept = append(kept, f)
+		}
+	}
+	return kept, nil
+}
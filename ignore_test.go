@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIgnore(t *testing.T) {
+	rules := ParseIgnore("# comment\n\n*.draft.md\n!keep.draft.md\ndrafts/\n/top.md\n")
+	expected := []IgnoreRule{
+		{"*.draft.md", false, false},
+		{"keep.draft.md", true, false},
+		{"drafts", false, true},
+		{"top.md", false, false},
+	}
+	assert.Equal(t, expected, rules)
+}
+
+func TestFilelistIgnore(t *testing.T) {
+	files, err := Filelist("./mock/ignore/*.md")
+	assert.NoError(t, err)
+	expected := []string{"mock/ignore/01.note.md", "mock/ignore/keep.draft.md"}
+	assert.Equal(t, expected, files)
+
+	// the whole drafts directory is ignored:
+	files, err = Filelist("./mock/ignore/*/*.md")
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestFilelistErrors(t *testing.T) {
+	_, err := Filelist("mock/[*.md")
+	assert.ErrorContains(t, err, `bad glob "mock/[*.md"`)
+
+	// an ignore file which can't be read, being a directory:
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "note.md"), []byte("# note.md\n+ foo\n"), 0644)
+	os.Mkdir(filepath.Join(dir, IGNORE_FILE), 0755)
+	_, err = Filelist(filepath.Join(dir, "*.md"))
+	assert.Error(t, err)
+	_, err = Filelists([]string{TEST_PATTERN, filepath.Join(dir, "*.md")})
+	assert.Error(t, err)
+}
+
+func TestGlobRoot(t *testing.T) {
+	assert.Equal(t, "mock", GlobRoot("./mock/*.md"))
+	assert.Equal(t, "mock/ignore", GlobRoot("mock/ignore/*/*.md"))
+	assert.Equal(t, ".", GlobRoot("*.md"))
+	assert.Equal(t, ".", GlobRoot("*/foo/*.md"))
+}
+
+func TestCommonRoot(t *testing.T) {
+	assert.Equal(t, "mock", CommonRoot([]string{"./mock/*.md"}))
+	assert.Equal(t, "mock", CommonRoot([]string{"mock/nested/a/*.md", "mock/ignore/*/*.md", "mock/01.foo.md"}))
+	assert.Equal(t, ".", CommonRoot([]string{"mock/*.md", "*.md"}))
+	assert.Equal(t, "/", CommonRoot([]string{"/tmp/*.md", "/var/*.md"}))
+}
+
+func TestFilelists(t *testing.T) {
+	// 01.foo.md and 02.foo.md match both patterns:
+	files, err := Filelists([]string{"./mock/0[12]*.md", "mock/*.foo.md", "./mock/04.baz.md", "mock/04.baz.md"})
+	assert.NoError(t, err)
+	expected := []string{"mock/01.foo.md", "mock/02.foo.md", "./mock/04.baz.md"}
+	assert.Equal(t, expected, files)
+
+	files, err = Filelists([]string{TEST_PATTERN, "./mock/0*.md"})
+	assert.NoError(t, err)
+	entries, err := ReadEntries(files, ReadOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 6)
+}
+
+func TestExclude(t *testing.T) {
+	files, err := Filelist(TEST_PATTERN)
+	assert.NoError(t, err)
+	assert.Len(t, files, 6)
+
+	// written differently from the include glob:
+	files, err = Exclude(files, []string{"mock/06.*.md"})
+	assert.NoError(t, err)
+	entries, err := ReadEntries(files, ReadOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 5)
+
+	files, err = Exclude(files, []string{"./mock/0[12]*", "./mock/05.quz.md"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mock/03.bar.md", "mock/04.baz.md"}, files)
+
+	_, err = Exclude(files, []string{"[bad"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// picks one of the labels from the terminal, returning its index, or -1 when
+// nothing was picked. only set when built with the interactive tag, so that the
+// default build needs nothing of the terminal.
+var selector func(labels []string) (int, error)
+
+// a line for each of the files, as Print orders them: the file, its date and its
+// tags.
+func Candidates(entries []Entry, collection map[string]Set, opts PrintOptions) (files []string, labels []string) {
+	entrymap := EntryMap(entries)
+	files = OrderFiles(entries, collection["files"], opts)
+	width := 0
+	for _, f := range files {
+		width = max(width, len(f))
+	}
+	for _, f := range files {
+		e := entrymap[f]
+		labels = append(labels, fmt.Sprintf("%-*s  %s  %s", width, f, FormatDate(e.date), strings.Join(e.tags, ",")))
+	}
+	return files, labels
+}
+
+// draws the labels with a cursor on the selected one, and moves it by the keys
+// read: the arrows or j and k, until enter picks it, or q or ctrl-c gives up.
+// the terminal is expected to be in raw mode, so lines end in \r\n.
+func Select(r io.Reader, w io.Writer, labels []string) (int, error) {
+	if len(labels) == 0 {
+		return -1, nil
+	}
+	draw := func(selected int, redraw bool) {
+		if redraw {
+			// back up over the list drawn before:
+			fmt.Fprintf(w, "\x1b[%dA", len(labels))
+		}
+		for i, label := range labels {
+			cursor := "  "
+			if i == selected {
+				cursor = "> "
+			}
+			fmt.Fprintf(w, "\r\x1b[K%s%s\r\n", cursor, label)
+		}
+	}
+	selected := 0
+	draw(selected, false)
+	keys := bufio.NewReader(r)
+	for {
+		key, err := keys.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return -1, nil
+			}
+			return -1, err
+		}
+		switch key {
+		case '\r', '\n':
+			return selected, nil
+		case 'q', 0x03:
+			return -1, nil
+		case 'k':
+			selected = max(selected-1, 0)
+		case 'j':
+			selected = min(selected+1, len(labels)-1)
+		case 0x1b:
+			// an arrow is ESC [ A for up, or ESC [ B for down:
+			if b, _ := keys.ReadByte(); b != '[' {
+				continue
+			}
+			switch b, _ := keys.ReadByte(); b {
+			case 'A':
+				selected = max(selected-1, 0)
+			case 'B':
+				selected = min(selected+1, len(labels)-1)
+			}
+		}
+		draw(selected, true)
+	}
+}
+
+// lists the matched files to pick from, and prints the whole content of the one
+// picked.
+func Interactive(w io.Writer, entries []Entry, collection map[string]Set, opts PrintOptions) error {
+	if selector == nil {
+		return errors.New("--interactive needs gag built with: go build -tags interactive")
+	}
+	files, labels := Candidates(entries, collection, opts)
+	i, err := selector(labels)
+	if err != nil || i < 0 {
+		return err
+	}
+	fmt.Fprint(w, EntryMap(entries)[files[i]].content)
+	return nil
+}
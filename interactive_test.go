@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCandidates(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("science")
+	collection := Collect(entries, Tagmap(entries), queries)
+
+	files, labels := Candidates(entries, collection, PrintOptions{sort: "date-desc"})
+	assert.Equal(t, []string{"04.baz.md", "02.foo.md", "03.bar.md"}, files)
+	expected := []string{
+		"04.baz.md  2024.10.09  science",
+		"02.foo.md  2024.09.25  sot,science",
+		"03.bar.md  2024.09.25  sot,science",
+	}
+	assert.Equal(t, expected, labels)
+}
+
+func TestSelect(t *testing.T) {
+	labels := []string{"a", "b", "c"}
+	for keys, expected := range map[string]int{
+		"\r":              0,
+		"jj\r":            2,
+		"jjjj\r":          2,
+		"\x1b[B\x1b[Bk\r": 1,
+		"\x1b[A\r":        0,
+		"jq":              -1,
+		"j\x03":           -1,
+		"j":               -1,
+	} {
+		var out bytes.Buffer
+		selected, err := Select(strings.NewReader(keys), &out, labels)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, selected, "%q", keys)
+	}
+
+	var out bytes.Buffer
+	Select(strings.NewReader("\r"), &out, labels)
+	assert.Equal(t, "\r\x1b[K> a\r\n\r\x1b[K  b\r\n\r\x1b[K  c\r\n", out.String())
+}
+
+func TestInteractive(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	collection := Collect(entries, Tagmap(entries), ParseQuery("science"))
+
+	old := selector
+	defer func() { selector = old }()
+
+	// as the default build has it:
+	selector = nil
+	var buf bytes.Buffer
+	assert.ErrorContains(t, Interactive(&buf, entries, collection, PrintOptions{}), "-tags interactive")
+
+	selector = func(labels []string) (int, error) { return 1, nil }
+	assert.NoError(t, Interactive(&buf, entries, collection, PrintOptions{}))
+	assert.Equal(t, "# 03.bar.md\n: 2024.09.25\n+ sot\n+ science\n\nBar.\n", buf.String())
+}
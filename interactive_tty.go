@@ -0,0 +1,38 @@
+//go:build interactive
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func init() {
+	selector = SelectTerminal
+}
+
+// selects from the controlling terminal rather than stdin and stdout, which may
+// be piped. raw mode is set and restored with stty, to need no dependencies.
+func SelectTerminal(labels []string) (int, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return -1, err
+	}
+	defer tty.Close()
+	stty := func(args ...string) (string, error) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = tty
+		out, err := cmd.Output()
+		return strings.TrimSpace(string(out)), err
+	}
+	state, err := stty("-g")
+	if err != nil {
+		return -1, err
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return -1, err
+	}
+	defer stty(state)
+	return Select(tty, tty, labels)
+}
@@ -1,88 +1,630 @@
 package main
 
 import (
+	"bufio"
+	"cmp"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log"
+	"maps"
+	"math"
 	"os"
 	"path/filepath"
 	"regexp"
 	"slices"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
 )
 
+// the layout of dates in headers and output.
+const DATE_FORMAT = "2006.01.02"
+
+// the layouts of dates accepted in headers, tried in order.
+var DATE_LAYOUTS = []string{DATE_FORMAT, "2006-01-02", "2006/01/02"}
+
+// the layout of an optional time of day following a date, as in 2024.09.25 14:30.
+const TIME_LAYOUT = "15:04"
+
 type Entry struct {
 	filename string
 	date     time.Time
 	content  string
 	tags     []string
+	// modification time of the file, for breaking ties between dates.
+	mtime time.Time
+	// the value of a numeric directive like ~ 42, nil if there is none.
+	number *float64
+	// the label of the Collection the file was read from, if any.
+	collection string
+	// the path the file was read from, where filename is only its base.
+	path string
+	// how many more times each tag listed twice or more was listed, which tags
+	// leave out. nil if none were.
+	repeats map[string]int
+	// the tags marked primary in the header, as in + science!. nil if none were.
+	primary Set
+}
+
+// where warnings are written. --quiet discards them, leaving stdout and fatal
+// errors untouched.
+var warnings io.Writer = os.Stderr
+
+// prints a non-fatal warning to stderr.
+func Warnf(format string, a ...any) {
+	fmt.Fprintf(warnings, "warning: "+format+"\n", a...)
 }
 
 // convenience shorthand for this awkward type:
 type Set map[string]bool
 
-func ParseQuery(query string) []string {
-	return strings.Split(query, ",")
+// returns the members of the set in sorted order.
+func (s Set) Members() []string {
+	members := []string{}
+	for m, _ := range s {
+		members = append(members, m)
+	}
+	slices.Sort(members)
+	return members
+}
+
+// returns a new set of the members found in both sets.
+func (s Set) Intersect(other Set) Set {
+	intersection := Set{}
+	for m, _ := range s {
+		if other[m] {
+			intersection[m] = true
+		}
+	}
+	return intersection
+}
+
+// returns a new set of the members found in either set.
+func (s Set) Union(other Set) Set {
+	union := Set{}
+	for m, _ := range s {
+		union[m] = true
+	}
+	for m, _ := range other {
+		union[m] = true
+	}
+	return union
+}
+
+// returns a new set of the members not found in the other set.
+func (s Set) Difference(other Set) Set {
+	difference := Set{}
+	for m, _ := range s {
+		if !other[m] {
+			difference[m] = true
+		}
+	}
+	return difference
+}
+
+// convenience constructor from a slice.
+func ToSet(items []string) Set {
+	set := Set{}
+	for _, i := range items {
+		set[i] = true
+	}
+	return set
+}
+
+// a query as an OR of groups, each group an AND of tags. tags lists every tag
+// of every group in order, for work done per tag like finding adjacencies.
+//
+// negated holds the tags each group must lack, in step with groups.
+type Query struct {
+	tags    []string
+	groups  [][]string
+	negated [][]string
+}
+
+// parses tags joined by , for OR or + for AND. + binds tighter than , so that
+// foo+bar,baz means (foo AND bar) OR baz. a tag prefixed with - excludes the
+// files carrying it from its group, as in science+-foo.
+//
+// ! subtracts the files of the tags following it from the whole of the query,
+// binding loosest of all: foo,bar!draft means (foo OR bar) NOT draft, and a bare
+// !draft every file without draft. each tag following it is subtracted, however
+// they're joined, so that foo!bar,baz and foo!bar+baz both mean foo NOT bar NOT
+// baz, as foo!bar!baz does.
+//
+// a tag marked with REGEX_PREFIX is a pattern, whose operators are split as
+// SplitTerms says, so that re:proj-.+ and re:a{1,3} stay whole.
+func ParseQuery(query string) Query {
+	return parseQuery(query, false)
+}
+
+// each tag of the query read as a regular expression, as if marked with
+// REGEX_PREFIX, with the operators applied between them.
+func RegexQuery(query string) Query {
+	prefix := func(tags []string) {
+		for i, tag := range tags {
+			if !strings.HasPrefix(tag, REGEX_PREFIX) {
+				tags[i] = REGEX_PREFIX + tag
+			}
+		}
+	}
+	q := parseQuery(query, true)
+	for _, tags := range slices.Concat([][]string{q.tags}, q.groups, q.negated) {
+		prefix(tags)
+	}
+	return q
+}
+
+// as ParseQuery, where regex reads every tag as a pattern.
+func parseQuery(query string, regex bool) Query {
+	q := Query{}
+	parts := SplitTerms(query, "!", regex)
+	query = parts[0]
+	subtracted := []string{}
+	for _, part := range parts[1:] {
+		for _, tag := range SplitTerms(part, "!,+", regex) {
+			if tag != "" {
+				subtracted = append(subtracted, tag)
+			}
+		}
+	}
+	for _, group := range SplitTerms(query, ",", regex) {
+		tags, negated := []string{}, []string{}
+		if group == "" && len(subtracted) > 0 {
+			q.groups = append(q.groups, tags)
+			q.negated = append(q.negated, subtracted)
+			continue
+		}
+		for _, tag := range SplitTerms(group, "+", regex) {
+			if neg, ok := strings.CutPrefix(tag, "-"); ok && neg != "" {
+				negated = append(negated, neg)
+			} else {
+				tags = append(tags, tag)
+			}
+		}
+		q.groups = append(q.groups, tags)
+		q.negated = append(q.negated, append(negated, subtracted...))
+		q.tags = append(q.tags, tags...)
+	}
+	return q
+}
+
+// splits the query at each of the separators, as strings.Split would, except
+// within a pattern: a tag marked with REGEX_PREFIX, or any tag if regex. there,
+// a separator inside (), [] or {} belongs to the pattern, as does a + following
+// ., ), ] or an escaped character, where it can only be a repetition. so
+// fo.*+sci.* is two patterns, but proj-.+ and a{1,3} one each.
+func SplitTerms(query string, separators string, regex bool) []string {
+	terms := []string{}
+	start, depth := 0, 0
+	pattern := func(term string) bool {
+		return regex || strings.HasPrefix(strings.TrimPrefix(term, "-"), REGEX_PREFIX)
+	}
+	inpattern := pattern(query)
+	// whether the last character could be repeated by a +:
+	repeatable := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		if inpattern {
+			switch {
+			case c == '\\' && i+1 < len(query):
+				i++
+				repeatable = true
+				continue
+			case strings.IndexByte("([{", c) >= 0:
+				depth++
+			case strings.IndexByte(")]}", c) >= 0 && depth > 0:
+				depth--
+			}
+			if strings.IndexByte(separators, c) >= 0 && (depth > 0 || (c == '+' && repeatable)) {
+				repeatable = false
+				continue
+			}
+		}
+		if strings.IndexByte(separators, c) >= 0 && depth == 0 {
+			terms = append(terms, query[start:i])
+			start = i + 1
+			inpattern = pattern(query[start:])
+			repeatable = false
+			continue
+		}
+		repeatable = strings.IndexByte(".)]", c) >= 0
+	}
+	return append(terms, query[start:])
 }
 
+// the header of a file: its YAML front matter if it opens with one, else all up
+// to the first blank line, or the whole of a file without one.
 func ParseHeader(content *string) string {
+	if matter, _, ok := CutFrontMatter(content); ok {
+		return matter
+	}
 	// returns complete string if not found:
 	header, _, _ := strings.Cut(*content, "\n\n")
 	return header
 }
 
-func ParseTags(content *string) (tags []string) {
-	r, _ := regexp.Compile(`(?m)^\+ (.+)$`)
+// the content following the header, empty if there is none.
+func ParseBody(content *string) string {
+	if _, body, ok := CutFrontMatter(content); ok {
+		return strings.TrimLeft(body, "\n")
+	}
+	_, body, _ := strings.Cut(*content, "\n\n")
+	return body
+}
+
+// the text of the first # heading, empty if there is none.
+func ParseTitle(content *string) string {
+	r, _ := regexp.Compile(`(?m)^# (.+)$`)
+	res := r.FindStringSubmatch(*content)
+	if len(res) < 2 {
+		return ""
+	}
+	return res[1]
+}
+
+// marks a tag line in the header, as in + science.
+const TAG_MARKER = "+ "
+
+// marks the date line in the header, as in : 2024.09.25.
+const DATE_MARKER = ": "
+
+// marks a tag in the header as primary to the file, as in + science!.
+const PRIMARY_MARKER = "!"
+
+// parses the tag lines of the header, each starting with the marker, or
+// TAG_MARKER when it's empty. a tag ending in PRIMARY_MARKER is listed by its
+// plain name, and also among the primary tags.
+func ParseTags(content *string, marker string) (tags []string, primary Set) {
+	r := regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(cmp.Or(marker, TAG_MARKER)) + `(.+)$`)
 	res := r.FindAllStringSubmatch(*content, -1)
 	for i := range res {
 		// group submatch is indexed at 1:
 		// this shouldn't ever fail if there's a result:
-		tags = append(tags, res[i][1])
+		tag := res[i][1]
+		if plain, ok := strings.CutSuffix(tag, PRIMARY_MARKER); ok && plain != "" {
+			if primary == nil {
+				primary = Set{}
+			}
+			primary[plain] = true
+			tag = plain
+		}
+		tags = append(tags, tag)
+	}
+	return tags, primary
+}
+
+// matches a #hashtag in the body: a # right after whitespace or the start of a
+// line, and followed by a letter, digit or underscore. so neither a # Heading nor
+// the #fragment of a URL.
+var HASHTAG = regexp.MustCompile(`(?:^|[\s(])#([\pL\pN_][\pL\pN_/-]*)`)
+
+// parses the #hashtags of a body, in order, without the #.
+func ParseHashtags(body *string) (tags []string) {
+	for _, res := range HASHTAG.FindAllStringSubmatch(*body, -1) {
+		// a hashtag ending a sentence or a path isn't part of it:
+		tags = append(tags, strings.TrimRight(res[1], "/-"))
 	}
 	return tags
 }
 
-func ParseDate(content *string) (time.Time, error) {
-	r, _ := regexp.Compile(`(?m)^\: (.+)\n`)
+// parses the date line of the header, starting with the marker, or DATE_MARKER
+// when it's empty.
+func ParseDate(content *string, marker string) (time.Time, error) {
+	r := regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(cmp.Or(marker, DATE_MARKER)) + `(.+)\n`)
 	res := r.FindStringSubmatch(*content)
 	if len(res) < 2 {
 		return time.Time{}, errors.New("failed to find date string")
 	}
-	// The layout string must be a representation of:
-	// Jan 2 15:04:05 2006 MST
-	// 1   2  3  4  5    6  -7
-	return time.Parse("2006.01.02", res[1])
+	return ParseDateLayouts(res[1])
+}
+
+// parses a date in the first of the DATE_LAYOUTS that fits, or returns the error
+// of the last one tried. the date may be followed by a time of day in
+// TIME_LAYOUT, else it falls at midnight.
+func ParseDateLayouts(date string) (t time.Time, err error) {
+	for _, layout := range DATE_LAYOUTS {
+		// The layout string must be a representation of:
+		// Jan 2 15:04:05 2006 MST
+		// 1   2  3  4  5    6  -7
+		if strings.Contains(date, " ") {
+			layout += " " + TIME_LAYOUT
+		}
+		if t, err = time.Parse(layout, date); err == nil {
+			return t, nil
+		}
+	}
+	return t, err
 }
 
-func ParseContent(filename string, content *string) Entry {
+// parses a file into an entry, from YAML front matter if the file opens with a
+// --- fence, else from : date and + tag lines. a missing or malformed date is
+// returned as an error alongside the entry, which is complete but for its zero
+// date. an empty or blank file is an entry with neither tags nor date, and no
+// error, since there's nothing malformed to warn about.
+func ParseContent(filename string, content *string, opts ReadOptions) (Entry, error) {
 	base := filepath.Base(filename)
-	header := ParseHeader(content)
-	date, _ := ParseDate(&header)
-	tags := ParseTags(&header)
+	if strings.TrimSpace(*content) == "" {
+		return Entry{filename: base, content: *content}, nil
+	}
+	var date time.Time
+	var tags []string
+	var primary Set
+	var err error
+	if matter, _, ok := CutFrontMatter(content); ok {
+		date, tags, err = ParseFrontMatter(matter)
+	} else {
+		header := ParseHeader(content)
+		date, err = ParseDate(&header, opts.datemarker)
+		tags, primary = ParseTags(&header, opts.tagmarker)
+	}
+	tags, repeats := UniqueTags(tags)
 	return Entry{
-		base,
-		date,
-		*content,
-		tags,
+		filename: base,
+		date:     date,
+		content:  *content,
+		tags:     tags,
+		repeats:  repeats,
+		primary:  primary,
+	}, err
+}
+
+// the entry with more tags added after its own, each still listed only once,
+// and any repeats counted.
+func AddTags(e Entry, tags []string) Entry {
+	unique, repeats := UniqueTags(slices.Concat(e.tags, tags))
+	for tag, n := range e.repeats {
+		if repeats == nil {
+			repeats = map[string]int{}
+		}
+		repeats[tag] += n
+	}
+	e.tags, e.repeats = unique, repeats
+	return e
+}
+
+// the tags with each listed only once, in the order first listed, and how many
+// more times each repeated tag was listed.
+func UniqueTags(tags []string) (unique []string, repeats map[string]int) {
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		if seen[tag] {
+			if repeats == nil {
+				repeats = map[string]int{}
+			}
+			repeats[tag]++
+			continue
+		}
+		seen[tag] = true
+		unique = append(unique, tag)
+	}
+	return unique, repeats
+}
+
+// settings for reading files into entries. the zero value reads UTF-8.
+type ReadOptions struct {
+	// decodes file bytes to UTF-8 before parsing. nil for files already in UTF-8.
+	encoding encoding.Encoding
+	// marks a numeric directive in the header. empty for NUMERIC_MARKER.
+	marker string
+	// mark the tag and date lines in the header. empty for TAG_MARKER and
+	// DATE_MARKER.
+	tagmarker  string
+	datemarker string
+	// only read this many lines from the top of each file, 0 for all of them.
+	// the header is all most queries need, and long files are slow to scan.
+	lines int
+	// skip files larger than this many bytes, 0 for no limit.
+	maxsize int64
+	// only read the header of each file, enough to query by tag and date. the
+	// rest is left for LoadContent, once the files worth reading are known.
+	headers bool
+	// key each entry by its path rather than its base name, so that files of the
+	// same name in different directories stay apart. the path is relative to
+	// root, when the file lies within it.
+	fullpath bool
+	root     string
+	// also tag each entry with the #hashtags of its body. needs the whole file,
+	// so overrides headers.
+	hashtags bool
+}
+
+// reads the first n lines of a file, keeping their line endings.
+func ReadLines(path string, n int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	dat := []byte{}
+	for range n {
+		line, err := r.ReadBytes('\n')
+		dat = append(dat, line...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
 	}
+	return dat, nil
 }
 
-func Entries(pattern string) (entries []Entry) {
-	files, err := filepath.Glob(pattern)
+// reads the header of a file: its YAML front matter, or else every line up to
+// the first blank one. keeps the line endings, and the blank line itself, so
+// that ParseHeader finds the same header as in the whole file.
+func ReadHeader(path string) ([]byte, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	dat := []byte{}
+	fenced := false
+	for i := 0; ; i++ {
+		line, err := r.ReadBytes('\n')
+		dat = append(dat, line...)
+		if err == io.EOF {
+			return dat, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case i == 0 && string(line) == FRONT_MATTER_FENCE:
+			fenced = true
+		case fenced && string(line) == FRONT_MATTER_FENCE:
+			return dat, nil
+		case !fenced && string(line) == "\n":
+			return dat, nil
+		}
+	}
+}
+
+// reads as much of a file as the options ask for, decoded to UTF-8.
+func ReadFile(path string, opts ReadOptions) (dat []byte, err error) {
+	switch {
+	case opts.headers:
+		dat, err = ReadHeader(path)
+	case opts.lines > 0:
+		dat, err = ReadLines(path, opts.lines)
+	default:
+		dat, err = os.ReadFile(path)
+	}
+	if err != nil || opts.encoding == nil {
+		return dat, err
+	}
+	if dat, err = opts.encoding.NewDecoder().Bytes(dat); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return dat, nil
+}
+
+// resolves a charset name like latin1 or windows-1252 to its encoding, nil
+// meaning UTF-8.
+func ParseEncoding(name string) (encoding.Encoding, error) {
+	if name == "" {
+		return nil, nil
+	}
+	return htmlindex.Get(name)
+}
+
+// the entries of the files matching the glob pattern, read as UTF-8.
+func Entries(pattern string) ([]Entry, error) {
+	files, err := Filelist(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return ReadEntries(files, ReadOptions{})
+}
+
+// reads the files into entries. files without a parseable date are still read,
+// but listed in a warning, since they drop out of any filtering by date.
+func ReadEntries(files []string, opts ReadOptions) (entries []Entry, err error) {
+	undated := []string{}
 	for _, f := range files {
-		dat, err := os.ReadFile(f)
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+		if opts.maxsize > 0 && info.Size() > opts.maxsize {
+			Warnf("skipping %s: %d bytes is over the maximum of %d", f, info.Size(), opts.maxsize)
+			continue
+		}
+		dat, err := ReadFile(f, opts)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		s := string(dat)
-		e := ParseContent(f, &s)
+		e, err := ParseContent(f, &s, opts)
+		if err != nil {
+			undated = append(undated, f)
+		}
+		e.path = f
+		if opts.hashtags {
+			body := ParseBody(&s)
+			e = AddTags(e, ParseHashtags(&body))
+		}
+		if opts.fullpath {
+			e.filename = RelativeName(f, opts.root)
+		}
+		e.mtime = info.ModTime()
+		marker := cmp.Or(opts.marker, NUMERIC_MARKER)
+		header := ParseHeader(&s)
+		if n, ok := ParseNumber(&header, marker); ok {
+			e.number = &n
+		}
 		entries = append(entries, e)
 	}
-	return entries
+	if len(undated) > 0 {
+		Warnf("failed to parse a date in %d files: %s", len(undated), strings.Join(undated, ", "))
+	}
+	collisions := Collisions(entries)
+	for _, name := range slices.Sorted(maps.Keys(collisions)) {
+		Warnf("%d files share the name %s, use --full-path to keep them apart: %s",
+			len(collisions[name]), name, strings.Join(collisions[name], ", "))
+	}
+	return entries, nil
+}
+
+// the path of a file relative to the root, or its whole path when it lies
+// outside the root, or there is none.
+func RelativeName(path string, root string) string {
+	if root != "" {
+		rel, err := filepath.Rel(root, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return rel
+		}
+	}
+	return filepath.Clean(path)
+}
+
+// maps each filename shared by several entries to their paths.
+func Collisions(entries []Entry) map[string][]string {
+	paths := map[string][]string{}
+	for _, e := range entries {
+		paths[e.filename] = append(paths[e.filename], cmp.Or(e.path, e.filename))
+	}
+	for name, p := range paths {
+		if len(p) < 2 {
+			delete(paths, name)
+		}
+	}
+	return paths
+}
+
+// reads the whole content of the given files, for entries read with only their
+// headers. returns new entries, leaving the rest with their headers alone.
+func LoadContent(entries []Entry, files Set, opts ReadOptions) ([]Entry, error) {
+	opts.headers = false
+	loaded := []Entry{}
+	for _, e := range entries {
+		if files[e.filename] {
+			dat, err := ReadFile(e.path, opts)
+			if err != nil {
+				return nil, err
+			}
+			e.content = string(dat)
+		}
+		loaded = append(loaded, e)
+	}
+	return loaded, nil
+}
+
+// maps filenames to their entries, for output which needs more than the name.
+func EntryMap(entries []Entry) map[string]Entry {
+	entrymap := map[string]Entry{}
+	for _, e := range entries {
+		entrymap[e.filename] = e
+	}
+	return entrymap
 }
 
 // maps tags to a set of filenames
@@ -100,36 +642,257 @@ func Tagmap(entries []Entry) (tagmap map[string]Set) {
 	return tagmap
 }
 
+// returns the n most used tags, ordered by file count descending and then by
+// name, so that ties are stable.
+func TopTags(tagmap map[string]Set, n int) []string {
+	tags := []string{}
+	for tag, _ := range tagmap {
+		tags = append(tags, tag)
+	}
+	slices.SortFunc(tags, func(a, b string) int {
+		if c := len(tagmap[b]) - len(tagmap[a]); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	if n < len(tags) {
+		tags = tags[:n]
+	}
+	return tags
+}
+
+// counts every occurrence of each tag across the entries. Tagmap counts a file
+// once however often it repeats a tag, so the two differ only where one does.
+func TagCounts(entries []Entry) map[string]int {
+	counts := map[string]int{}
+	for _, e := range entries {
+		for _, tag := range e.tags {
+			counts[tag]++
+		}
+		for tag, n := range e.repeats {
+			counts[tag] += n
+		}
+	}
+	return counts
+}
+
+// the connected components of the adjacency graph: groups of tags linked to each
+// other through shared files, directly or by way of other tags. each group is in
+// name order, and the groups are ordered by their first tag.
+func Clusters(adjacencies map[string]Set) [][]string {
+	seen := Set{}
+	clusters := [][]string{}
+	for _, tag := range slices.Sorted(maps.Keys(adjacencies)) {
+		if seen[tag] {
+			continue
+		}
+		cluster := Set{}
+		queue := []string{tag}
+		seen[tag] = true
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+			cluster[current] = true
+			for neighbor := range adjacencies[current] {
+				if !seen[neighbor] {
+					seen[neighbor] = true
+					queue = append(queue, neighbor)
+				}
+			}
+		}
+		clusters = append(clusters, cluster.Members())
+	}
+	return clusters
+}
+
+// an undirected edge between two tags, weighted by the number of files in which
+// they occur together.
+type Pair struct {
+	a      string
+	b      string
+	weight float64
+}
+
+// flattens the weighted adjacency graph of AdjacencyCounts into pairs of tags,
+// each pair once with its tags in order, sorted by weight descending and then
+// by name.
+func Pairs(entries []Entry) []Pair {
+	pairs := []Pair{}
+	for tag, counts := range AdjacencyCounts(entries) {
+		for other, n := range counts {
+			if tag < other {
+				pairs = append(pairs, Pair{tag, other, float64(n)})
+			}
+		}
+	}
+	SortPairs(pairs)
+	return pairs
+}
+
+// sorts pairs by weight descending and then by name.
+func SortPairs(pairs []Pair) {
+	slices.SortFunc(pairs, func(x, y Pair) int {
+		if c := cmp.Compare(y.weight, x.weight); c != 0 {
+			return c
+		}
+		if c := strings.Compare(x.a, y.a); c != 0 {
+			return c
+		}
+		return strings.Compare(x.b, y.b)
+	})
+}
+
+// reweights pairs by the rarity of their tags, like TF-IDF, so that common tags
+// don't dominate: the count of files shared is multiplied by each tag's inverse
+// document frequency, log(total files / files with the tag). a tag found in
+// every file weighs nothing.
+func IDFWeight(pairs []Pair, tagmap map[string]Set, total int) []Pair {
+	idf := func(tag string) float64 {
+		return math.Log(float64(total) / float64(len(tagmap[tag])))
+	}
+	weighted := []Pair{}
+	for _, p := range pairs {
+		weighted = append(weighted, Pair{p.a, p.b, p.weight * idf(p.a) * idf(p.b)})
+	}
+	SortPairs(weighted)
+	return weighted
+}
+
+// marks a query tag as a regular expression, as --regex does for every tag.
+const REGEX_PREFIX = "re:"
+
+// the pattern a query tag matches tags by: a regular expression following
+// REGEX_PREFIX, or one built from * wildcards. both must match the whole tag.
+// nil for a plain tag, matching only itself.
+func TagPattern(query string) (*regexp.Regexp, error) {
+	if expr, ok := strings.CutPrefix(query, REGEX_PREFIX); ok {
+		r, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("bad regex in query tag %q: %w", query, err)
+		}
+		return r, nil
+	}
+	if !strings.Contains(query, "*") {
+		return nil, nil
+	}
+	parts := strings.Split(query, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	// anchored, so that pre*suf doesn't match inside a longer tag:
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$"), nil
+}
+
+// expands a query containing * wildcards, or a regular expression, into the
+// matching keys of the map, in sorted order. a * matches any run of characters,
+// so the pattern may have wildcards anywhere: *sci*, pre*, *suf, pre*suf.
+// without either, the query is returned as is.
+func MatchTags(tagmap map[string]Set, query string) []string {
+	r, err := TagPattern(query)
+	if err != nil {
+		// CheckPatterns reports a bad regex before it gets here:
+		return []string{}
+	}
+	if r == nil {
+		return []string{query}
+	}
+
+	matches := []string{}
+	for tag, _ := range tagmap {
+		if r.MatchString(tag) {
+			matches = append(matches, tag)
+		}
+	}
+	slices.Sort(matches)
+	return matches
+}
+
+// checks that every regular expression in the query compiles.
+func CheckPatterns(queries Query) error {
+	for g := range queries.groups {
+		for _, query := range slices.Concat(queries.groups[g], queries.negated[g]) {
+			if _, err := TagPattern(query); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// separates the levels of a hierarchical tag, as in science/biology.
+const TAG_SEPARATOR = "/"
+
+// rolls hierarchical tags up into their ancestors, so that science carries the
+// files of science/biology and science/physics as well as its own, and has the
+// neighbors of each subtag, along with the subtags themselves. returns new maps.
+func Hierarchy(tagmap map[string]Set, adjacencies map[string]Set) (map[string]Set, map[string]Set) {
+	rolled := CloneTagmap(tagmap)
+	neighbors := CloneTagmap(adjacencies)
+	for tag, files := range tagmap {
+		parts := strings.Split(tag, TAG_SEPARATOR)
+		for i := 1; i < len(parts); i++ {
+			parent := strings.Join(parts[:i], TAG_SEPARATOR)
+			rolled[parent] = rolled[parent].Union(files)
+			adjacent := neighbors[parent].Union(adjacencies[tag])
+			adjacent[tag] = true
+			delete(adjacent, parent)
+			neighbors[parent] = adjacent
+		}
+	}
+	return rolled, neighbors
+}
+
+// a deep copy, so that a tagmap can be modified without affecting the original.
+func CloneTagmap(tagmap map[string]Set) map[string]Set {
+	clone := map[string]Set{}
+	for tag, files := range tagmap {
+		clone[tag] = maps.Clone(files)
+	}
+	return clone
+}
+
 // adjacencies is a map from tag to other tags occuring in all files.
 //
 // technically a map[tag]set : go's "set" being a map[T]bool.
 func Adjacencies(entries []Entry) (adjacencies map[string]Set) {
 	adjacencies = map[string]Set{}
+	for tag, counts := range AdjacencyCounts(entries) {
+		adjacencies[tag] = Set{}
+		for other := range counts {
+			adjacencies[tag][other] = true
+		}
+	}
+	return adjacencies
+}
 
+// like Adjacencies, but counting the files each pair of tags occurs in together:
+// the strength of the adjacency, where Adjacencies keeps only that there is one.
+// a tag alone in its files maps to an empty count, and a tag repeated in a file
+// counts once.
+func AdjacencyCounts(entries []Entry) (counts map[string]map[string]int) {
+	counts = map[string]map[string]int{}
 	for _, e := range entries {
-		for i, tag := range e.tags {
-			others := make([]string, len(e.tags))
-			copy(others, e.tags)
-			others = slices.Delete(others, i, i+1)
-
-			_, ok := adjacencies[tag]
-			if !ok {
-				adjacencies[tag] = Set{}
+		tags := ToSet(e.tags).Members()
+		for i, tag := range tags {
+			if _, ok := counts[tag]; !ok {
+				counts[tag] = map[string]int{}
 			}
-			for _, other := range others {
-				adjacencies[tag][other] = true
+			for j, other := range tags {
+				if i != j {
+					counts[tag][other]++
+				}
 			}
 		}
 	}
-	return adjacencies
+	return counts
 }
 
 // extends the tagmap to include files which contain the query string, like grepping.
-func Grep(entries []Entry, tagmap map[string]Set, queries []string) map[string]Set {
+func Grep(entries []Entry, tagmap map[string]Set, queries Query) map[string]Set {
 	for _, e := range entries {
-		for _, query := range queries {
-			// TODO: in the presence of multiple query strings, this is an OR.
-			// Should be an AND.
+		for _, query := range queries.tags {
+			// each query string gets its own set, which ProcessQueries then
+			// combines according to the operator.
 			if strings.Contains(strings.ToLower(e.content), query) {
 				_, ok := tagmap[query]
 				if !ok {
@@ -143,9 +906,9 @@ func Grep(entries []Entry, tagmap map[string]Set, queries []string) map[string]S
 }
 
 // extends the tagmap to include filenames which contain the query string, like find.
-func Find(entries []Entry, tagmap map[string]Set, queries []string) map[string]Set {
+func Find(entries []Entry, tagmap map[string]Set, queries Query) map[string]Set {
 	for _, e := range entries {
-		for _, query := range queries {
+		for _, query := range queries.tags {
 			if strings.Contains(e.filename, query) {
 				_, ok := tagmap[query]
 				if !ok {
@@ -159,9 +922,9 @@ func Find(entries []Entry, tagmap map[string]Set, queries []string) map[string]S
 }
 
 // shrinks the tagmap to exclude filenames which contain the query as a tag.
-func Diff(entries []Entry, tagmap map[string]Set, queries []string) map[string]Set {
+func Diff(entries []Entry, tagmap map[string]Set, queries Query) map[string]Set {
 	for _, e := range entries {
-		for _, query := range queries {
+		for _, query := range queries.tags {
 			if slices.Contains(e.tags, query) {
 				_, ok := tagmap[query]
 				if ok {
@@ -173,116 +936,1218 @@ func Diff(entries []Entry, tagmap map[string]Set, queries []string) map[string]S
 	return tagmap
 }
 
-// collects our maps between all tags:files and all tags:tags, into one Set of
-// files, and one Set of adjacent tags.
-//
-// NOTE: would be more efficient to only map the relevant queried tag to file,
-// but Adjacencies() is easier knowing about all tags.
-func Collect(
-	tagmap map[string]Set,
-	adjacencies map[string]Set,
-	queries []string,
-) (collection map[string]Set) {
-	collection = map[string]Set{}
-	collection["files"] = Set{}
-	collection["adjacencies"] = Set{}
+// the Jaccard similarity of two sets: the size of their intersection over the
+// size of their union.
+func Jaccard(a Set, b Set) float64 {
+	union := a.Union(b)
+	if len(union) == 0 {
+		return 0
+	}
+	return float64(len(a.Intersect(b))) / float64(len(union))
+}
 
-	for _, query := range queries {
-		for file, _ := range tagmap[query] {
-			collection["files"][file] = true
+type Score struct {
+	filename string
+	score    float64
+}
+
+// scores each file by the similarity of its tags to the query tags, ordered by
+// score descending and then by filename.
+//
+// useful for ranking the results of an OR query, where some files match more of
+// the query than others.
+func Similarity(entries []Entry, files Set, queries Query) (scores []Score) {
+	q := ToSet(queries.tags)
+	for _, e := range entries {
+		if files[e.filename] {
+			scores = append(scores, Score{e.filename, Jaccard(ToSet(e.tags), q)})
 		}
 	}
-
-	for _, query := range queries {
-		for tag, val := range adjacencies[query] {
-			if val {
-				collection["adjacencies"][tag] = true
+	slices.SortFunc(scores, func(a, b Score) int {
+		if a.score != b.score {
+			if a.score > b.score {
+				return -1
 			}
+			return 1
 		}
+		return strings.Compare(a.filename, b.filename)
+	})
+	return scores
+}
+
+// the files carrying any tag which matches the query tag.
+func MatchFiles(tagmap map[string]Set, query string) Set {
+	set := Set{}
+	for _, match := range MatchTags(tagmap, query) {
+		set = set.Union(tagmap[match])
 	}
-	return collection
+	return set
 }
 
-// prints out the complete and ordered collection of files, adjacencies, sums,
-// and original query tags.
-//
-// default format is a TOML syntax possibly useful elsewhere. the pipe flag will
-// spit out a simple list suitable for piping to cat.
-func PrintCollection(collection map[string]Set, queries []string, pipe bool) {
-	// sort the collection of files only by proxy at the last moment.
-	ordered_files := []string{}
-	for f, _ := range collection["files"] {
-		ordered_files = append(ordered_files, f)
+// the set of files matching the query: the intersection of each tag's files
+// within a group for an AND, less the files of its negated tags, and the union
+// of the groups for an OR. a group of only negated tags starts from every entry,
+// so that -foo matches the files lacking foo, including untagged ones.
+func ProcessQueries(entries []Entry, tagmap map[string]Set, queries Query) Set {
+	files := Set{}
+	for g, group := range queries.groups {
+		var intersection Set
+		for i, query := range group {
+			if i == 0 {
+				intersection = MatchFiles(tagmap, query)
+			} else {
+				intersection = intersection.Intersect(MatchFiles(tagmap, query))
+			}
+		}
+		if len(group) == 0 {
+			intersection = Invert(entries, Set{})
+		}
+		for _, query := range queries.negated[g] {
+			intersection = intersection.Difference(MatchFiles(tagmap, query))
+		}
+		files = files.Union(intersection)
 	}
-	slices.Sort(ordered_files)
+	return files
+}
 
-	// build up strings
-	files := fmt.Sprintln("[files]")
-	for _, f := range ordered_files {
-		files += fmt.Sprintln(f)
+// every tag of the tagmap matched by any of the query tags.
+func QueryTags(tagmap map[string]Set, queries Query) Set {
+	matched := Set{}
+	for _, query := range queries.tags {
+		for _, match := range MatchTags(tagmap, query) {
+			matched[match] = true
+		}
 	}
+	return matched
+}
 
-	tags := fmt.Sprintln("[tags]")
-	for _, q := range queries {
-		tags += fmt.Sprintln(q)
+// the set of tags adjacent to the result: every tag carried by the matched files,
+// but a query tag only where it shares a file with another, as sot does with
+// science in sot,science. computed once over the files, so that an OR query
+// shows only the neighbors of the files it found, and an inverted one the
+// neighbors of the files it kept.
+func ReduceAdjacencies(entries []Entry, tagmap map[string]Set, files Set, queries Query) Set {
+	matched := QueryTags(tagmap, queries)
+	reduced := Set{}
+	for _, e := range entries {
+		if !files[e.filename] {
+			continue
+		}
+		shared := len(ToSet(e.tags).Intersect(matched)) > 1
+		for _, tag := range e.tags {
+			if shared || !matched[tag] {
+				reduced[tag] = true
+			}
+		}
 	}
+	return reduced
+}
 
-	adj := fmt.Sprintln("[adjacencies]")
-	for t, _ := range collection["adjacencies"] {
-		adj += fmt.Sprintln(t)
+// the adjacencies sharing at least n files with the query tags, by their
+// weights from SharedWeights.
+func MinAdjacency(adjacencies Set, weights map[string]int, n int) Set {
+	kept := Set{}
+	for tag := range adjacencies {
+		if weights[tag] >= n {
+			kept[tag] = true
+		}
+	}
+	return kept
+}
+
+// the set of tags adjacent to every one of the query tags: their common
+// neighbors. most useful for an AND query, where the union of each tag's
+// neighbors says little about the files they share.
+func CommonAdjacencies(adjacencies map[string]Set, queries Query) (common Set) {
+	for i, query := range queries.tags {
+		set := Set{}
+		for _, match := range MatchTags(adjacencies, query) {
+			set = set.Union(adjacencies[match])
+		}
+		if i == 0 {
+			common = set
+		} else {
+			common = common.Intersect(set)
+		}
+	}
+	return common
+}
+
+// the files carrying any tag at all, whatever it is.
+func HasTags(entries []Entry) Set {
+	tagged := Set{}
+	for _, e := range entries {
+		if len(e.tags) > 0 {
+			tagged[e.filename] = true
+		}
+	}
+	return tagged
+}
+
+// filters the files down to those where a query tag is the only tag: notes which
+// lack any other context.
+func Orphans(entries []Entry, tagmap map[string]Set, files Set, queries Query) Set {
+	tags := QueryTags(tagmap, queries)
+	orphans := Set{}
+	for _, e := range entries {
+		unique := ToSet(e.tags)
+		if files[e.filename] && len(unique) == 1 && len(unique.Intersect(tags)) == 1 {
+			orphans[e.filename] = true
+		}
+	}
+	return orphans
+}
+
+// every tag carried by any of the files, including the query tags themselves,
+// sorted and without duplicates.
+func ResultTags(entries []Entry, files Set) []string {
+	tags := Set{}
+	for _, e := range entries {
+		if files[e.filename] {
+			tags = tags.Union(ToSet(e.tags))
+		}
+	}
+	return tags.Members()
+}
+
+// filters the files down to those whose name contains the pattern, or matches
+// it as a glob when it has any of *?[ in it, as in journal-*.
+func Name(files Set, pattern string) (Set, error) {
+	named := Set{}
+	for f := range files {
+		ok := strings.Contains(f, pattern)
+		if strings.ContainsAny(pattern, "*?[") {
+			var err error
+			if ok, err = filepath.Match(pattern, f); err != nil {
+				return nil, fmt.Errorf("bad --name glob %q: %w", pattern, err)
+			}
+		}
+		if ok {
+			named[f] = true
+		}
+	}
+	return named, nil
+}
+
+// the files not in the given set: the complement within the whole collection.
+func Invert(entries []Entry, files Set) Set {
+	inverted := Set{}
+	for _, e := range entries {
+		if !files[e.filename] {
+			inverted[e.filename] = true
+		}
+	}
+	return inverted
+}
+
+// EXPERIMENTAL: the files carrying every tag which all the given files have in
+// common, searched across the whole collection. a way to find more files like
+// the ones matched, say by --grep, or the most representative of a loose query.
+//
+// if the given files have no tag in common, nothing is representative.
+func Superset(entries []Entry, files Set) Set {
+	var common Set
+	for _, e := range entries {
+		if !files[e.filename] {
+			continue
+		}
+		if common == nil {
+			common = ToSet(e.tags)
+		} else {
+			common = common.Intersect(ToSet(e.tags))
+		}
+	}
+
+	superset := Set{}
+	if len(common) == 0 {
+		return superset
+	}
+	for _, e := range entries {
+		if len(ToSet(e.tags).Intersect(common)) == len(common) {
+			superset[e.filename] = true
+		}
+	}
+	return superset
+}
+
+// a query tag's own neighbors, each weighted by the number of files it shares
+// with the query tag.
+type Group struct {
+	tag     string
+	weights map[string]int
+}
+
+// the neighbors of each query tag kept apart, rather than reduced into one set,
+// in the order of the query. wildcards expand into a group per matching tag.
+func GroupAdjacencies(tagmap map[string]Set, adjacencies map[string]Set, queries Query) (groups []Group) {
+	for _, query := range queries.tags {
+		for _, match := range MatchTags(adjacencies, query) {
+			g := Group{match, map[string]int{}}
+			for tag, _ := range adjacencies[match] {
+				g.weights[tag] = len(tagmap[match].Intersect(tagmap[tag]))
+			}
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// each of the given tags, mapped to those of the given files carrying it.
+func TagFiles(entries []Entry, files Set, tags Set) map[string]Set {
+	shared := map[string]Set{}
+	for t := range tags {
+		shared[t] = Set{}
+	}
+	for _, e := range entries {
+		if !files[e.filename] {
+			continue
+		}
+		for _, t := range e.tags {
+			if _, ok := shared[t]; ok {
+				shared[t][e.filename] = true
+			}
+		}
+	}
+	return shared
+}
+
+// the number of the given files carrying each of the given tags.
+func SharedWeights(entries []Entry, files Set, tags Set) map[string]int {
+	weights := map[string]int{}
+	for t, shared := range TagFiles(entries, files, tags) {
+		weights[t] = len(shared)
+	}
+	return weights
+}
+
+// orders the keys of weights by weight descending and then by name.
+func SortWeights(weights map[string]int) []string {
+	keys := slices.Collect(maps.Keys(weights))
+	slices.SortFunc(keys, func(a, b string) int {
+		if c := weights[b] - weights[a]; c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	return keys
+}
+
+// collects our map between all tags:files into one Set of files, and the tags
+// adjacent to those files into another.
+func Collect(entries []Entry, tagmap map[string]Set, queries Query) (collection map[string]Set) {
+	collection = map[string]Set{}
+	collection["files"] = ProcessQueries(entries, tagmap, queries)
+	collection["adjacencies"] = ReduceAdjacencies(entries, tagmap, collection["files"], queries)
+	return collection
+}
+
+// the ways files can be ordered for printing.
+var SORTS = []string{"name", "date", "date-desc", "priority"}
+
+// and the ways ties between equal dates can be broken.
+var TIEBREAKS = []string{"name", "mtime"}
+
+// orders the files by name, or by date, oldest first, or with date-desc newest
+// first. files with equal dates fall back to the tiebreak: by name, or by
+// modification time, newest first.
+func SortFiles(entries []Entry, files Set, by string, tiebreak string) []string {
+	ordered := files.Members()
+	if by != "date" && by != "date-desc" {
+		return ordered
+	}
+	entrymap := EntryMap(entries)
+	// stable, so that ties keep the name order unless broken by mtime:
+	slices.SortStableFunc(ordered, func(a, b string) int {
+		c := entrymap[a].date.Compare(entrymap[b].date)
+		if by == "date-desc" {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+		if tiebreak == "mtime" {
+			return entrymap[b].mtime.Compare(entrymap[a].mtime)
+		}
+		return 0
+	})
+	return ordered
+}
+
+// reorders the files so that those marking any of the tags primary come first,
+// keeping the order otherwise.
+func SortPriority(entries []Entry, ordered []string, tags Set) []string {
+	entrymap := EntryMap(entries)
+	slices.SortStableFunc(ordered, func(a, b string) int {
+		pa := len(entrymap[a].primary.Intersect(tags)) > 0
+		pb := len(entrymap[b].primary.Intersect(tags)) > 0
+		switch {
+		case pa && !pb:
+			return -1
+		case pb && !pa:
+			return 1
+		}
+		return 0
+	})
+	return ordered
+}
+
+// the files in the order they print, sorted and cut down to the limit.
+func OrderFiles(entries []Entry, files Set, opts PrintOptions) []string {
+	ordered := SortFiles(entries, files, opts.sort, opts.tiebreak)
+	if opts.sort == "priority" {
+		ordered = SortPriority(entries, ordered, opts.primary)
+	}
+	return Limit(ordered, opts.limit)
+}
+
+// the first limit items, or all of them when the limit is 0 or beyond them.
+func Limit[T any](items []T, limit int) []T {
+	if limit > 0 && limit < len(items) {
+		return items[:limit]
+	}
+	return items
+}
+
+// settings for Print. the zero value prints everything, files ordered by name.
+type PrintOptions struct {
+	// only print the files, for piping.
+	pipe bool
+	// with pipe, end each file with a NUL byte instead of a newline.
+	print0 bool
+	// order files by one of SORTS, breaking ties by one of TIEBREAKS.
+	sort     string
+	tiebreak string
+	// when set, prints the weight of each adjacency, heaviest first.
+	weights map[string]int
+	// when set, replaces the flat [adjacencies] with a subsection per query tag.
+	groups []Group
+	// color the tags in the [tags] and [adjacencies] sections.
+	color bool
+	// add a [months] section counting the files dated in each month.
+	histogram bool
+	// print only the first this many files, 0 for all of them.
+	limit int
+	// with sort priority, the tags whose files sort first where they're marked
+	// primary: the tags matching the query.
+	primary Set
+}
+
+// prints out the complete and ordered collection of files, adjacencies, sums,
+// and original query tags.
+//
+// default format is a TOML syntax possibly useful elsewhere. the pipe option will
+// spit out a simple list suitable for piping to cat.
+func Print(w io.Writer, entries []Entry, collection map[string]Set, queries Query, opts PrintOptions) {
+	// sort the collection of files only by proxy at the last moment.
+	ordered_files := OrderFiles(entries, collection["files"], opts)
+
+	// build up strings
+	files := fmt.Sprintln("[files]")
+	for _, f := range ordered_files {
+		files += fmt.Sprintln(f)
+	}
+
+	tags := fmt.Sprintln("[tags]")
+	for _, q := range queries.tags {
+		tags += fmt.Sprintln(q)
+	}
+
+	counts := map[string]int{
+		"files":       len(collection["files"]),
+		"adjacencies": len(collection["adjacencies"]),
+		"words":       WordCount(entries, collection["files"]),
+		"shown":       len(ordered_files),
+	}
+	sumkeys := []string{"files", "adjacencies", "words"}
+	// when cut short by the limit, say how many of the files were shown:
+	if len(ordered_files) < len(collection["files"]) {
+		sumkeys = []string{"files", "shown", "adjacencies", "words"}
+	}
+	weights := map[string]int{}
+	for t := range collection["adjacencies"] {
+		weights[t] = opts.weights[t]
+	}
+	// every count lines up to the widest one printed, whichever section it's in:
+	all := []map[string]int{counts}
+	if opts.groups != nil {
+		for _, g := range opts.groups {
+			all = append(all, g.weights)
+		}
+	} else if opts.weights != nil {
+		all = append(all, weights)
+	}
+	var months map[string]int
+	if opts.histogram {
+		// month is always a known bucket:
+		months, _ = ByDate(entries, collection["files"], "month")
+		all = append(all, months)
+	}
+	width := CountWidth(all...)
+
+	adj := fmt.Sprintln("[adjacencies]")
+	if opts.groups != nil {
+		adj = SprintGroups(opts.groups, width)
+	} else if opts.weights != nil {
+		adj += SprintCounts(SortWeights(weights), weights, width)
+	} else {
+		// without weights, the strongest neighbors still come first:
+		shared := SharedWeights(entries, collection["files"], collection["adjacencies"])
+		for _, t := range SortWeights(shared) {
+			adj += fmt.Sprintln(t)
+		}
+	}
+
+	if opts.color {
+		tags, adj = ColorKeys(tags), ColorKeys(adj)
+	}
+
+	hist := ""
+	if opts.histogram {
+		hist = fmt.Sprintln("[months]")
+		hist += SprintCounts(slices.Sorted(maps.Keys(months)), months, width)
 	}
 
 	sums := fmt.Sprintln("[sums]")
-	sums += fmt.Sprintln("files =", len(collection["files"]))
-	sums += fmt.Sprintln("adjacencies =", len(collection["adjacencies"]))
+	sums += SprintCounts(sumkeys, counts, width)
 
-	if pipe {
+	if opts.pipe && opts.print0 {
+		for _, f := range ordered_files {
+			fmt.Fprint(w, f, "\x00")
+		}
+		return
+	}
+	if opts.pipe {
 		// slice off including the newline:
 		files = files[8:]
-		fmt.Println(files)
+		fmt.Fprintln(w, files)
 		return
 	}
-	fmt.Println(files)
-	fmt.Println(tags)
-	fmt.Println(adj)
-	fmt.Println(sums)
+	fmt.Fprintln(w, files)
+	fmt.Fprintln(w, tags)
+	fmt.Fprintln(w, adj)
+	if hist != "" {
+		fmt.Fprintln(w, hist)
+	}
+	fmt.Fprintln(w, sums)
+}
+
+// the total number of words in the bodies of the given files, split on
+// whitespace. the header isn't counted.
+func WordCount(entries []Entry, files Set) int {
+	words := 0
+	for _, e := range entries {
+		if _, ok := files[e.filename]; ok {
+			words += len(strings.Fields(ParseBody(&e.content)))
+		}
+	}
+	return words
+}
+
+// the number of digits in the largest of all the counts.
+func CountWidth(counts ...map[string]int) int {
+	width := 1
+	for _, c := range counts {
+		for _, n := range c {
+			width = max(width, len(strconv.Itoa(n)))
+		}
+	}
+	return width
+}
+
+// formats the counts of keys as key = value lines, in the order given. the =
+// signs line up, and the values are right-aligned to width so digits line up.
+func SprintCounts(keys []string, counts map[string]int, width int) string {
+	pad := 0
+	for _, k := range keys {
+		pad = max(pad, len(k))
+	}
+	s := ""
+	for _, k := range keys {
+		s += fmt.Sprintf("%-*s = %*d\n", pad, k, width, counts[k])
+	}
+	return s
+}
+
+// formats each group as a TOML subtable of [adjacencies], listing its neighbors
+// with their weights right-aligned to width.
+func SprintGroups(groups []Group, width int) string {
+	subsections := []string{}
+	for _, g := range groups {
+		sub := fmt.Sprintf("[adjacencies.%s]\n", g.tag)
+		sub += SprintCounts(SortWeights(g.weights), g.weights, width)
+		subsections = append(subsections, sub)
+	}
+	return strings.Join(subsections, "\n")
+}
+
+// reads a query from a file, such as a profile of tags. a single line is parsed
+// like any query, while tags on separate lines must all match, as an AND. blank
+// lines and # comments are skipped.
+func ReadQuery(path string) (string, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	lines := []string{}
+	for _, line := range strings.Split(string(dat), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "+"), nil
+}
+
+// consulted for a query when none is passed, handy for shell aliases.
+const QUERY_ENV = "GAG_QUERY"
+
+// the query passed explicitly, else the first positional arg, else the query
+// in the environment.
+func ResolveQuery(query string, args []string) string {
+	if query != "" {
+		return query
+	}
+	// take first positional arg as query:
+	// NOTE: all flags must precede: gag --grep arg
+	if len(args) > 0 {
+		return args[0]
+	}
+	return os.Getenv(QUERY_ENV)
+}
+
+// prints the top n tags with their file counts, in the same TOML syntax as
+// Print. given raw counts of occurrences, ranks by those instead, and prints
+// both counts for each tag.
+func PrintTopTags(w io.Writer, tagmap map[string]Set, raw map[string]int, n int) {
+	top := fmt.Sprintln("[top-tags]")
+	if raw == nil {
+		for _, tag := range TopTags(tagmap, n) {
+			top += fmt.Sprintln(tag, "=", len(tagmap[tag]))
+		}
+	} else {
+		tags := SortWeights(raw)
+		for _, tag := range tags[:min(n, len(tags))] {
+			top += fmt.Sprintf("%s = { occurrences = %d, files = %d }\n", tag, raw[tag], len(tagmap[tag]))
+		}
+	}
+	fmt.Fprintln(w, top)
+}
+
+// formats every tag with the number of files carrying it, most used first and
+// then by name, as a TOML table.
+func SprintTagSummary(tagmap map[string]Set) string {
+	counts := map[string]int{}
+	for tag, files := range tagmap {
+		counts[tag] = len(files)
+	}
+	return fmt.Sprintln("[tags]") + SprintCounts(TopTags(tagmap, len(tagmap)), counts, CountWidth(counts))
+}
+
+// a flag which may be repeated, collecting each value in order.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
 
 func main() {
-	var glob = flag.String("glob", "./*md", "search for files with this glob pattern.")
-	var query = flag.String("query", "", "search for files with the given tag(s). "+
-		"This option may be passed implicitly as the first arg.")
+	var globs listFlag
+	flag.Var(&globs, "glob", "search for files with this glob pattern, by default ./*md. "+
+		"May be repeated to search several at once. "+
+		"A list of files piped to stdin, one per line or as a JSON array, takes precedence.")
+	var nots listFlag
+	flag.Var(&nots, "not", "leave out files carrying this tag, whatever the query. May be repeated.")
+	var excludes listFlag
+	flag.Var(&excludes, "exclude-glob", "leave out files matching this glob pattern. May be repeated.")
+	var collectionspecs listFlag
+	flag.Var(&collectionspecs, "collection", "read the files of a labeled collection, as NAME=GLOB, instead of --glob. "+
+		"May be repeated to query several at once, with each file prefixed by its label.")
+	var query = flag.String("query", "", "search for files with the given tag(s), "+
+		"joined by , for OR or + for AND, where + binds tighter: foo+bar,baz is (foo AND bar) OR baz. "+
+		"A - before a tag excludes its files, as in science+-foo. "+
+		"A ! subtracts the tags after it from the whole query, binding loosest: a+b,c!d is ((a AND b) OR c) NOT d. "+
+		"A * in a tag matches any characters, as in *sci*. "+
+		"This option may be passed implicitly as the first arg, or else read from $"+QUERY_ENV+".")
+	var regex = flag.Bool("regex", false, "read each query tag as a regular expression matching the whole tag, "+
+		"as in proj-.* for every tag starting with proj-. Operators inside (), [] or {}, and a + following . ) or ], "+
+		"belong to the pattern, as in proj-.+ or a{1,3}. A single tag may be marked so with re:, as in foo,re:proj-.*")
+	var aliasfile = flag.String("aliases", "", "read aliases from this file, as lines of alias = canonical, "+
+		"and replace aliased query tags with their canonical tags.")
+	var aliastags = flag.Bool("alias-tags", false, "with --aliases, also replace aliased tags in the files as they're read.")
+	var queryfrom = flag.String("query-from", "", "read the query from this file: tags on separate lines must all match.")
 	var grep = flag.Bool("grep", false, "whether to show files containing the query as content.")
 	var find = flag.Bool("find", false, "whether to show files containing the query as filename.")
 	var diff = flag.Bool("diff", false, "whether to omit files containing the query as tag.")
+	var invert = flag.Bool("invert", false, "whether to show the files NOT matching the query.")
+	var audit = flag.Bool("audit", false, "whether to print the files matching the query alongside their complement, "+
+		"to check an --invert. Ignored with --pipe.")
+	var hashtags = flag.Bool("hashtags", false, "whether to also tag files with the #hashtags found in their body.")
+	var fullpath = flag.Bool("full-path", false, "whether to name files by their path from the root of the globs "+
+		"rather than their base name, so that files of the same name in different directories stay apart.")
+	var limit = flag.Int("limit", 0, "print only the first N files, after sorting, as in --sort date-desc --limit 10 for the newest ten.")
+	var output = flag.String("output", "", "write the results to this file instead of stdout, replacing it.")
 	var pipe = flag.Bool("pipe", false, "whether to only print files for piping.")
+	var print0 = flag.Bool("print0", false, "like --pipe, but end each file with a NUL byte instead of a newline, for xargs -0.")
+	var sortby = flag.String("sort", "name", "order files by name, date, date-desc for newest first, "+
+		"or priority for those marking a query tag primary first, as in + science!.")
+	var tiebreak = flag.String("tiebreak", "name", "with --sort date, order files of the same date by name, "+
+		"or by mtime with the newest first.")
+	var color = flag.String("color", "auto", "color the tags printed: always, never, or auto, only when printing to a terminal.")
+	var html = flag.Bool("html", false, "whether to print files as an HTML table.")
+	var json = flag.Bool("json", false, "whether to print files as JSON. Overrides --pipe or --verbose set in a config file.")
+	var verbose = flag.Bool("verbose", false, "print every section of the output, as by default, "+
+		"even with --pipe set in a config file. Can't be combined with --json.")
+	var jsonl = flag.Bool("jsonl", false, "whether to print each file as a JSON object on its own line, "+
+		"in the order read unless --sort is given.")
+	var content = flag.Bool("json-content", false, "whether to include the body of each file in JSON or JSONL output.")
+	var rss = flag.Bool("rss", false, "whether to print files as an RSS feed, newest first.")
+	var profile = flag.Bool("profile", false, "whether to print the time spent in each phase to stderr.")
+	var format = flag.String("format", "", "print each file with this Go template, as in '{{.filename}} {{.date.Year}}'. "+
+		"Fields are filename, date, tags, content, mtime, number and collection.")
+	var prefix = flag.Bool("prefix", false, "whether a query tag also matches its subtags, "+
+		"so that science matches science/biology.")
+	var dot = flag.Bool("dot", false, "whether to print the tags of the matched files as a Graphviz DOT graph, "+
+		"with an edge between tags sharing files.")
+	var count = flag.Bool("count", false, "whether to print only the number of matched files.")
+	var resulttags = flag.Bool("list-result-tags", false, "whether to print every tag of the matched files, one per line.")
+	flag.BoolVar(resulttags, "tags-only", false, "the same as --list-result-tags.")
+	var yamladj = flag.Bool("yaml-adjacencies", false, "whether to print the neighbors of each query tag as YAML, with counts.")
+	var table = flag.Bool("table", false, "whether to print files as a table of file, date and tags.")
+	var interactive = flag.Bool("interactive", false, "whether to pick one of the matched files with the arrow keys, "+
+		"and print its content. Needs gag built with -tags interactive.")
+	var cat = flag.Bool("cat", false, "whether to print the whole content of the files, one after another.")
+	var separator = flag.String("cat-separator", "\n\n", "with --cat, the text printed between files.")
+	var bydate = flag.Bool("by-date", false, "whether to print the number of files on each date.")
+	var histogram = flag.Bool("histogram", false, "whether to add the number of files dated in each month to the output.")
+	var bucket = flag.String("bucket", "day", "with --by-date, group dates by day, month or year.")
+	var similarity = flag.Bool("similarity", false, "whether to rank files by the similarity of their tags to the query.")
+	var repl = flag.Bool("repl", false, "whether to read queries line by line from stdin, parsing the files only once. "+
+		"An empty line ends the session.")
+	var watch = flag.Bool("watch", false, "whether to re-run the query whenever the matched files change, "+
+		"clearing a terminal before each run after the first.")
+	var debounce = flag.Duration("debounce", 300*time.Millisecond, "in watch mode, coalesce changes arriving within this window into one re-run.")
+	var recent = flag.Float64("recent", 0, "show only the newest PERCENT of files by date, as in 10 for the newest tenth.")
+	var date = flag.String("date", "", "show only files dated within this date or range of dates, as in "+
+		"2024.09.25 or 2024.09.01-2024.09.30, or several joined by a comma. A time of day narrows a date, "+
+		"as in 2024.09.25 12:00-2024.09.25 18:00. A partial date like 2024 or 2024.09 covers the whole year or month. "+
+		"Relative dates like today, yesterday, 7d, 2w or 1m count back from today, as in 7d-yesterday.")
+	var since = flag.String("since", "", "show only files dated on or after this date, through today, "+
+		"as in 2024.09.01 or 2w. Combines with --until into a range.")
+	var until = flag.String("until", "", "show only files dated on or before this date, as in 2024.09.30 or yesterday.")
+	var mtime = flag.Bool("mtime", false, "with --date, --since, --until or --recent, date files lacking a date line by when they were last modified.")
+	var priority = flag.String("priority", "", "show only files whose numeric directive satisfies this comparison: "+
+		">30, >=30, <30, <=30, =30, or a range as in 10-20.")
+	var tagmarker = flag.String("tag-prefix", TAG_MARKER, "the marker starting each tag line in the header, "+
+		"including any space after it, as in @ for @science.")
+	var datemarker = flag.String("date-prefix", DATE_MARKER, "the marker starting the date line in the header, "+
+		"including any space after it, as in \"date: \" for date: 2024.09.25.")
+	var marker = flag.String("numeric-marker", NUMERIC_MARKER, "the marker of a numeric directive in the header, as in: ~ 42")
+	var name = flag.String("name", "", "show only files whose name contains this, or matches it as a glob, as in journal-*.")
+	var hastags = flag.Bool("has-tags", false, "whether to show only files carrying any tag at all. "+
+		"with no query, starts from every file, so that with --invert it finds the untagged ones.")
+	var orphans = flag.Bool("orphans", false, "whether to show only files where the query tag is the only tag.")
+	var superset = flag.Bool("superset", false, "EXPERIMENTAL: whether to show all files carrying every tag the matched files share.")
+	var group = flag.Bool("group", false, "whether to list the neighbors of each query tag separately, with counts.")
+	var minadjacency = flag.Int("min-adjacency", 1, "show only adjacent tags sharing at least N files with the query tags.")
+	var common = flag.Bool("common", false, "whether to show only tags adjacent to every query tag.")
+	var rename = flag.String("rename", "", "rename a tag in file headers, given as old=new. "+
+		"Only previews the edits, unless --write is passed.")
+	var write = flag.Bool("write", false, "whether to apply the edits of a write operation, rather than a dry run.")
+	flag.BoolVar(write, "apply", false, "the same as --write.")
+	var backup = flag.Bool("backup", true, "with --write, whether to first copy each file to be edited aside, "+
+		"with "+BACKUP_SUFFIX+" appended to its name.")
+	var charset = flag.String("encoding", "", "decode files from this charset, like latin1, rather than UTF-8.")
+	var scanlines = flag.Int("scan-lines", 0, "only read this many lines from the top of each file, for speed. "+
+		"Content past them is invisible to --grep and the like.")
+	var lazy = flag.Bool("lazy", false, "whether to read only the headers of files until the query has matched, "+
+		"then the content of just those. Saves memory on large collections, unless --grep needs every file's content.")
+	var maxsize = flag.Int64("max-file-size", 0, "skip files larger than this many bytes, with a warning. 0 for no limit.")
+	var quiet = flag.Bool("quiet", false, "whether to suppress warnings on stderr.")
+	var listfiles = flag.Bool("list-files", false, "print the files which would be read, after globbing, excludes and stdin, "+
+		"without reading them.")
+	var dump = flag.Bool("dump-tagmap", false, "print the map of every tag to its files as JSON, instead of querying.")
+	var clusters = flag.Bool("clusters", false, "print the groups of tags linked to each other through shared files, instead of querying.")
+	var toppairs = flag.Int("top-pairs", 0, "print the N pairs of tags which share the most files, instead of querying.")
+	var idf = flag.Bool("idf-weight", false, "with --top-pairs, weight pairs by the rarity of their tags, so common tags don't dominate.")
+	var validate = flag.Bool("validate", false, "check every tag for likely mistakes, instead of querying.")
+	var strict = flag.Bool("strict", false, "list every file without tags or a date to stderr, and exit with an error if there are any.")
+	var tagregex = flag.String("tag-regex", SUSPICIOUS_TAGS, "with --validate, the pattern of suspicious tags.")
+	var export = flag.String("export-index", "", "write every file as JSON to this path, for client-side search, instead of querying.")
+	var typos = flag.Int("typos", 0, "list clusters of tags within this edit distance of each other, "+
+		"as likely typos, instead of querying.")
+	var top = flag.Int("top-tags", 0, "print the N most used tags with their file counts, instead of querying.")
+	var rawcounts = flag.Bool("raw-counts", false, "with --top-tags, count every occurrence of a tag rather than the files carrying it.")
 	flag.Parse()
+	// flags given on the command line override those of a config file:
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	if path, ok := FindConfig(); ok {
+		config, err := ReadConfig(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := ApplyConfig(flag.CommandLine, config); err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+	}
+	if len(globs) == 0 {
+		globs = listFlag{"./*md"}
+	}
 
-	// take first positional arg as query:
-	// NOTE: all flags must precede: gag --grep arg
-	if *query == "" {
-		if len(flag.Args()) > 0 {
-			*query = flag.Args()[0]
+	if *quiet {
+		warnings = io.Discard
+	}
+	enc, err := ParseEncoding(*charset)
+	if err != nil {
+		log.Fatalf("unknown encoding %q", *charset)
+	}
+	opts := ReadOptions{
+		encoding:   enc,
+		marker:     *marker,
+		tagmarker:  *tagmarker,
+		datemarker: *datemarker,
+		lines:      *scanlines,
+		maxsize:    *maxsize,
+		fullpath:   *fullpath,
+		root:       CommonRoot(globs),
+		hashtags:   *hashtags,
+	}
+	if !slices.Contains(SORTS, *sortby) {
+		log.Fatalf("unknown --sort %q, expected one of %v", *sortby, SORTS)
+	}
+	if !slices.Contains(TIEBREAKS, *tiebreak) {
+		log.Fatalf("unknown --tiebreak %q, expected one of %v", *tiebreak, TIEBREAKS)
+	}
+	if !slices.Contains(COLORS, *color) {
+		log.Fatalf("unknown --color %q, expected one of %v", *color, COLORS)
+	}
+	var tmpl *template.Template
+	if *format != "" {
+		if tmpl, err = ParseFormat(*format); err != nil {
+			log.Fatalf("bad --format template: %v", err)
+		}
+	}
+	aliases := map[string]string{}
+	if *aliasfile != "" {
+		if aliases, err = ReadAliases(*aliasfile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// --json overrides the other outputs when they're only set by a config file,
+	// and can't be combined with them on the command line:
+	if *json && given["verbose"] {
+		log.Fatal("--json and --verbose can't be combined: pick one output")
+	}
+	if *json && (given["pipe"] || given["print0"]) {
+		log.Fatal("--json and --pipe can't be combined: pick one output")
+	}
+	if *json {
+		*verbose, *pipe, *print0 = false, false, false
+	}
+	if *print0 {
+		*pipe = true
+	}
+	if *verbose {
+		*pipe, *print0 = false, false
+	}
+	// streamed output is left in the order read, unless a sort was asked for:
+	sorted := false
+	flag.Visit(func(f *flag.Flag) {
+		sorted = sorted || f.Name == "sort"
+	})
+	// the results reach a terminal only when they aren't written to a file:
+	terminal := *output == "" && isStdoutTerminal()
+	printopts := PrintOptions{
+		pipe:      *pipe,
+		print0:    *print0,
+		sort:      *sortby,
+		tiebreak:  *tiebreak,
+		color:     UseColor(*color, terminal),
+		histogram: *histogram,
+		limit:     *limit,
+	}
+	collections := []Collection{}
+	for _, spec := range collectionspecs {
+		c, err := ParseCollection(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		collections = append(collections, c)
+	}
+
+	// a list of files piped to stdin takes precedence over the glob. a repl reads
+	// its queries from stdin instead.
+	var piped []string
+	if !*repl && isStdinLoaded() {
+		if piped, err = GetStdin(os.Stdin); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// the files of the collections, or else those piped or globbed, less the
+	// excluded ones:
+	findfiles := func() ([]string, error) {
+		if len(collections) > 0 {
+			return CollectionFiles(collections, excludes)
+		}
+		var err error
+		files := piped
+		if len(files) == 0 {
+			if files, err = Filelists(globs); err != nil {
+				return nil, err
+			}
+		}
+		return Exclude(files, excludes)
+	}
+	filelist := func() []string {
+		files, err := findfiles()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return files
+	}
+	// reads every file in the filelist, or of the collections, for the modes
+	// short of a query:
+	readall := func() []Entry {
+		if len(collections) > 0 {
+			entries, err := ReadCollections(collections, excludes, opts)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return entries
+		}
+		entries, err := ReadEntries(filelist(), opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return entries
+	}
+
+	if *listfiles {
+		files := filelist()
+		slices.Sort(files)
+		for _, f := range files {
+			fmt.Println(f)
+		}
+		return
+	}
+
+	if *rename != "" {
+		old, new, ok := strings.Cut(*rename, "=")
+		if !ok {
+			log.Fatalf("--rename expects old=new, got %q", *rename)
+		}
+		edits, err := RenameTag(filelist(), old, new, *tagmarker)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := Rewrite(os.Stdout, edits, *write, *backup); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *export != "" {
+		f, err := os.Create(*export)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		if err := ExportIndex(f, readall()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *dump {
+		if err := PrintTagmap(os.Stdout, Tagmap(readall())); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *validate {
+		pattern, err := regexp.Compile(*tagregex)
+		if err != nil {
+			log.Fatal(err)
+		}
+		PrintSuspicious(os.Stdout, Suspicious(Tagmap(readall()), pattern))
+		return
+	}
+
+	if *typos > 0 {
+		tagmap := Tagmap(readall())
+		PrintTypos(os.Stdout, tagmap, Typos(tagmap, *typos))
+		return
+	}
+
+	if *clusters {
+		PrintClusters(os.Stdout, Clusters(Adjacencies(readall())))
+		return
+	}
+
+	if *toppairs > 0 {
+		entries := readall()
+		pairs := Pairs(entries)
+		if *idf {
+			pairs = IDFWeight(pairs, Tagmap(entries), len(entries))
+		}
+		PrintPairs(os.Stdout, pairs, *toppairs)
+		return
+	}
+
+	if *top > 0 {
+		entries := readall()
+		var raw map[string]int
+		if *rawcounts {
+			raw = TagCounts(entries)
+		}
+		PrintTopTags(os.Stdout, Tagmap(entries), raw, *top)
+		return
+	}
+
+	var profiler *Profiler
+	if *profile {
+		profiler = NewProfiler(os.Stderr)
+	}
+
+	// grep searches the content of every file, and hashtags are found in it, so
+	// neither can wait for it:
+	readopts := opts
+	readopts.headers = *lazy && !*grep && !*hashtags
+	// reads and parses the files, once per run, or once for a whole repl:
+	load := func() ([]Entry, map[string]Set, map[string]Set) {
+		var entries []Entry
+		if len(collections) > 0 {
+			if entries, err = ReadCollections(collections, excludes, readopts); err != nil {
+				log.Fatal(err)
+			}
+			profiler.Mark("read")
 		} else {
+			files := filelist()
+			profiler.Mark("glob")
+			if entries, err = ReadEntries(files, readopts); err != nil {
+				log.Fatal(err)
+			}
+			profiler.Mark("read")
+			if len(entries) == 0 {
+				Warnf("no files match the glob %q", strings.Join(globs, " "))
+			}
+		}
+		if *strict {
+			if untagged, undated := Malformed(entries); len(untagged)+len(undated) > 0 {
+				PrintMalformed(os.Stderr, untagged, undated)
+				os.Exit(1)
+			}
+		}
+		if *aliastags {
+			entries = AliasEntries(entries, aliases)
+		}
+		tagmap := Tagmap(entries)
+		profiler.Mark("tagmap")
+		adjacencies := Adjacencies(entries)
+		profiler.Mark("adjacencies")
+		return entries, tagmap, adjacencies
+	}
+
+	// the query pipeline over parsed entries:
+	searchopts := SearchOptions{
+		prefix:       *prefix,
+		grep:         *grep,
+		find:         *find,
+		diff:         *diff,
+		invert:       *invert,
+		hastags:      *hastags,
+		not:          nots,
+		common:       *common,
+		minadjacency: *minadjacency,
+		superset:     *superset,
+		orphans:      *orphans,
+		date:         *date,
+		since:        *since,
+		until:        *until,
+		mtime:        *mtime,
+		recent:       *recent,
+		priority:     *priority,
+		name:         *name,
+	}
+	search := func(w io.Writer, entries []Entry, tagmap map[string]Set, adjacencies map[string]Set, queries Query) {
+		files, neighbors, err := SearchMaps(entries, tagmap, adjacencies, queries, searchopts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		collection := SearchCollection(files, neighbors)
+		profiler.Mark("query")
+		printopts := printopts
+		printopts.primary = QueryTags(tagmap, queries)
+		if readopts.headers {
+			if entries, err = LoadContent(entries, collection["files"], opts); err != nil {
+				log.Fatal(err)
+			}
+		}
+		switch {
+		case *count:
+			fmt.Fprintln(w, len(collection["files"]))
+		case *dot:
+			PrintDOT(w, entries, collection["files"])
+		case *html:
+			if err := PrintHTML(w, collection, entries, printopts); err != nil {
+				log.Fatal(err)
+			}
+		case *json:
+			opts := printopts
+			opts.weights = SharedWeights(entries, collection["files"], collection["adjacencies"])
+			if err := PrintJSON(w, collection, entries, queries, opts, *content); err != nil {
+				log.Fatal(err)
+			}
+		case *jsonl:
+			opts := printopts
+			if !sorted {
+				opts.sort = ""
+			}
+			if err := PrintJSONL(w, entries, collection["files"], opts, *content); err != nil {
+				log.Fatal(err)
+			}
+		case *rss:
+			if err := PrintRSS(w, collection, entries, queries, printopts); err != nil {
+				log.Fatal(err)
+			}
+		case tmpl != nil:
+			if err := PrintFormat(w, collection, entries, tmpl, printopts); err != nil {
+				log.Fatal(err)
+			}
+		case *resulttags:
+			for _, tag := range ResultTags(entries, collection["files"]) {
+				fmt.Fprintln(w, tag)
+			}
+		case *yamladj:
+			// the modes built on the tagmap see it as the query did, with grep,
+			// find and diff applied:
+			tagmap, adjacencies := SearchTagmap(entries, tagmap, adjacencies, queries, searchopts)
+			if err := PrintYAML(w, GroupAdjacencies(tagmap, adjacencies, queries)); err != nil {
+				log.Fatal(err)
+			}
+		case *table:
+			PrintTable(w, collection, entries, printopts)
+		case *interactive:
+			if err := Interactive(w, entries, collection, printopts); err != nil {
+				log.Fatal(err)
+			}
+		case *cat:
+			PrintCat(w, collection, entries, *separator, printopts)
+		case *bydate:
+			counts, err := ByDate(entries, collection["files"], *bucket)
+			if err != nil {
+				log.Fatal(err)
+			}
+			PrintByDate(w, counts)
+		case *similarity:
+			PrintSimilarity(w, Similarity(entries, collection["files"], queries), printopts)
+		case *group:
+			tagmap, adjacencies := SearchTagmap(entries, tagmap, adjacencies, queries, searchopts)
+			opts := printopts
+			opts.groups = GroupAdjacencies(tagmap, adjacencies, queries)
+			Print(w, entries, collection, queries, opts)
+		case *audit && !*pipe:
+			tagmap, _ := SearchTagmap(entries, tagmap, adjacencies, queries, searchopts)
+			matched := ProcessQueries(entries, tagmap, queries)
+			PrintAudit(w, matched, Invert(entries, matched))
+		default:
+			opts := printopts
+			opts.weights = SharedWeights(entries, collection["files"], collection["adjacencies"])
+			Print(w, entries, collection, queries, opts)
+		}
+		profiler.Mark("print")
+	}
+
+	// a query as typed, with its aliases replaced, and with --regex its tags read
+	// as patterns:
+	parse := func(query string) Query {
+		if *regex {
+			return AliasQuery(RegexQuery(query), aliases)
+		}
+		return AliasQuery(ParseQuery(query), aliases)
+	}
+
+	if *repl {
+		entries, tagmap, adjacencies := load()
+		err := Repl(os.Stdin, os.Stdout, parse, func(w io.Writer, queries Query) {
+			// a mistyped pattern shouldn't end the session:
+			if err := CheckPatterns(queries); err != nil {
+				Warnf("%v", err)
+				return
+			}
+			search(w, entries, tagmap, adjacencies, queries)
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *queryfrom != "" {
+		q, err := ReadQuery(*queryfrom)
+		if err != nil {
+			log.Fatal(err)
+		}
+		*query = q
+	}
+	*query = ResolveQuery(*query, flag.Args())
+	// where results are written: stdout, or the --output file, truncated afresh on
+	// each call, as on each run of --watch. done closes it.
+	create := func() (w io.Writer, done func()) {
+		if *output == "" {
+			return os.Stdout, func() {}
+		}
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return f, func() { f.Close() }
+	}
+	if *query == "" && !*hastags {
+		// without a query, summarize the tags of whatever files there are:
+		entries, tagmap, _ := load()
+		if len(entries) == 0 {
 			flag.Usage()
 			return
 		}
+		w, done := create()
+		defer done()
+		fmt.Fprint(w, SprintTagSummary(tagmap))
+		return
 	}
 
-	queries := ParseQuery(*query)
-	entries := Entries(*glob)
-	tagmap := Tagmap(entries)
-	adjacencies := Adjacencies(entries)
-	if *grep {
-		tagmap = Grep(entries, tagmap, queries)
+	queries := parse(*query)
+	if *query == "" {
+		// --has-tags alone starts from every file, as a bare !tag would:
+		queries = Query{groups: [][]string{{}}, negated: [][]string{{}}}
 	}
-	if *find {
-		tagmap = Find(entries, tagmap, queries)
+	if err := CheckPatterns(queries); err != nil {
+		log.Fatal(err)
 	}
-	if *diff {
-		tagmap = Diff(entries, tagmap, queries)
+	run := func() {
+		entries, tagmap, adjacencies := load()
+		w, done := create()
+		defer done()
+		search(w, entries, tagmap, adjacencies, queries)
+	}
+	run()
+	if *watch {
+		// the files load reads, so that a collection or an excluded file is
+		// watched as it's searched:
+		Watch(findfiles, *debounce, func() {
+			// reprinted in place, like a dashboard:
+			if terminal {
+				fmt.Print(CLEAR_SCREEN)
+			}
+			run()
+		})
 	}
-
-	collection := Collect(tagmap, adjacencies, queries)
-	PrintCollection(collection, queries, *pipe)
 }
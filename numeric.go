@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// the default marker of a numeric directive in a header, as in: ~ 42
+const NUMERIC_MARKER = "~"
+
+// parses the value of the first numeric directive in the header.
+func ParseNumber(header *string, marker string) (float64, bool) {
+	r := regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(marker) + ` (.+)$`)
+	res := r.FindStringSubmatch(*header)
+	if len(res) < 2 {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(res[1]), 64)
+	return n, err == nil
+}
+
+// parses a numeric comparison into a predicate: >30, >=30, <30, <=30, =30 or just
+// 30, or an inclusive range as in 10-20.
+func ParseComparison(expr string) (func(float64) bool, error) {
+	expr = strings.TrimSpace(expr)
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if !strings.HasPrefix(expr, op) {
+			continue
+		}
+		n, err := strconv.ParseFloat(strings.TrimPrefix(expr, op), 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number in comparison %q", expr)
+		}
+		switch op {
+		case ">=":
+			return func(v float64) bool { return v >= n }, nil
+		case "<=":
+			return func(v float64) bool { return v <= n }, nil
+		case ">":
+			return func(v float64) bool { return v > n }, nil
+		case "<":
+			return func(v float64) bool { return v < n }, nil
+		default:
+			return func(v float64) bool { return v == n }, nil
+		}
+	}
+
+	// skip the first character when looking for a range, which may be a minus:
+	if i := strings.Index(expr[min(1, len(expr)):], "-"); i >= 0 {
+		lo, errlo := strconv.ParseFloat(expr[:i+1], 64)
+		hi, errhi := strconv.ParseFloat(expr[i+2:], 64)
+		if errlo != nil || errhi != nil {
+			return nil, fmt.Errorf("bad range in comparison %q", expr)
+		}
+		return func(v float64) bool { return lo <= v && v <= hi }, nil
+	}
+
+	n, err := strconv.ParseFloat(expr, 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad comparison %q", expr)
+	}
+	return func(v float64) bool { return v == n }, nil
+}
+
+// filters the files down to those whose numeric directive satisfies the
+// comparison. files without a directive never match.
+func Numeric(entries []Entry, files Set, expr string) (Set, error) {
+	compare, err := ParseComparison(expr)
+	if err != nil {
+		return nil, err
+	}
+	matched := Set{}
+	for _, e := range entries {
+		if files[e.filename] && e.number != nil && compare(*e.number) {
+			matched[e.filename] = true
+		}
+	}
+	return matched, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNumber(t *testing.T) {
+	header := "# 01.md\n: 2024.12.01\n~ 30.5\n+ task"
+	n, ok := ParseNumber(&header, "~")
+	assert.True(t, ok)
+	assert.Equal(t, 30.5, n)
+
+	header = "# 01.md\n: 2024.12.01\n% 7\n+ task"
+	_, ok = ParseNumber(&header, "~")
+	assert.False(t, ok)
+	n, ok = ParseNumber(&header, "%")
+	assert.True(t, ok)
+	assert.Equal(t, 7.0, n)
+}
+
+func TestNumeric(t *testing.T) {
+	entries := mockEntries(t, "./mock/numeric/*.md")
+	files := ProcessQueries(entries, Tagmap(entries), ParseQuery("task"))
+
+	for expr, expected := range map[string]Set{
+		">30":   {"02.high.md": true, "03.mid.md": true},
+		">=42":  {"02.high.md": true},
+		"<30":   {"01.low.md": true},
+		"<=10":  {"01.low.md": true},
+		"=42":   {"02.high.md": true},
+		"30.5":  {"03.mid.md": true},
+		"10-31": {"01.low.md": true, "03.mid.md": true},
+		"-5-10": {"01.low.md": true},
+		"<0":    {},
+	} {
+		matched, err := Numeric(entries, files, expr)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, matched, expr)
+	}
+
+	for _, expr := range []string{">", "abc", "10-x", ""} {
+		_, err := Numeric(entries, files, expr)
+		assert.Error(t, err, expr)
+	}
+}
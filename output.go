@@ -0,0 +1,377 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// formats a date as in the headers, leaving a missing date empty rather than
+// printing year 1.
+func FormatDate(date time.Time) string {
+	if date.IsZero() {
+		return ""
+	}
+	return date.Format(DATE_FORMAT)
+}
+
+// html/template escapes every field, so filenames and tags are safe to embed.
+var HTML_TEMPLATE = template.Must(template.New("html").Parse(`<table>
+<tr><th>file</th><th>date</th><th>tags</th></tr>
+{{- range .}}
+<tr><td>{{.Filename}}</td><td>{{.Date}}</td><td>{{.Tags}}</td></tr>
+{{- end}}
+</table>
+`))
+
+// a row of the HTML table. fields must be exported for the template.
+type HTMLRow struct {
+	Filename string
+	Date     string
+	Tags     string
+}
+
+// prints the collection of files as an HTML table of filename, date and tags,
+// ordered and limited as Print would.
+func PrintHTML(w io.Writer, collection map[string]Set, entries []Entry, opts PrintOptions) error {
+	entrymap := EntryMap(entries)
+	rows := []HTMLRow{}
+	for _, f := range OrderFiles(entries, collection["files"], opts) {
+		e := entrymap[f]
+		rows = append(rows, HTMLRow{f, FormatDate(e.date), strings.Join(e.tags, ", ")})
+	}
+	return HTML_TEMPLATE.Execute(w, rows)
+}
+
+// prints each file with its similarity score, in the order given, up to the
+// limit of opts.
+func PrintSimilarity(w io.Writer, scores []Score, opts PrintOptions) {
+	fmt.Fprintln(w, "[similarity]")
+	for _, s := range Limit(scores, opts.limit) {
+		fmt.Fprintf(w, "%s = %.2f\n", s.filename, s.score)
+	}
+}
+
+// a file as represented in JSON output.
+type JSONEntry struct {
+	Filename string   `json:"filename"`
+	Date     string   `json:"date"`
+	Tags     []string `json:"tags"`
+	Content  *string  `json:"content,omitempty"`
+}
+
+// the whole collection as represented in JSON output, mirroring Print.
+type JSONOutput struct {
+	Files       []JSONEntry    `json:"files"`
+	Tags        []string       `json:"tags"`
+	Adjacencies map[string]int `json:"adjacencies"`
+	Sums        JSONSums       `json:"sums"`
+}
+
+// the sums as Print gives them, shown only when the limit cut the files short.
+type JSONSums struct {
+	Files       int `json:"files"`
+	Shown       int `json:"shown,omitempty"`
+	Adjacencies int `json:"adjacencies"`
+	Words       int `json:"words"`
+}
+
+// prints the collection as a JSON object of the files ordered and limited as
+// Print would, the query tags, each adjacency with its weight from opts, and the
+// sums. encoding/json sorts the adjacencies by name, so the output is stable.
+// the body of each file, without its header, is included only if asked for,
+// since it can make for very large output.
+func PrintJSON(w io.Writer, collection map[string]Set, entries []Entry, queries Query, opts PrintOptions, content bool) error {
+	entrymap := EntryMap(entries)
+	out := JSONOutput{Files: []JSONEntry{}, Tags: []string{}, Adjacencies: map[string]int{}}
+	for _, f := range OrderFiles(entries, collection["files"], opts) {
+		e := entrymap[f]
+		row := JSONEntry{Filename: f, Tags: []string{}}
+		row.Date = FormatDate(e.date)
+		row.Tags = append(row.Tags, e.tags...)
+		if content {
+			body := ParseBody(&e.content)
+			row.Content = &body
+		}
+		out.Files = append(out.Files, row)
+	}
+	out.Tags = append(out.Tags, queries.tags...)
+	for t := range collection["adjacencies"] {
+		out.Adjacencies[t] = opts.weights[t]
+	}
+	out.Sums = JSONSums{
+		Files:       len(collection["files"]),
+		Adjacencies: len(collection["adjacencies"]),
+		Words:       WordCount(entries, collection["files"]),
+	}
+	if len(out.Files) < out.Sums.Files {
+		out.Sums.Shown = len(out.Files)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
+
+// prints one JSON object per matched file on its own line, written as each is
+// found rather than gathered first, for piping large results into other tools.
+// files follow the order they were read in, unless opts asks for a sort, as
+// Print would order them. the limit applies either way.
+func PrintJSONL(w io.Writer, entries []Entry, files Set, opts PrintOptions, content bool) error {
+	if opts.sort != "" {
+		entrymap := EntryMap(entries)
+		sorted := []Entry{}
+		for _, f := range OrderFiles(entries, files, opts) {
+			sorted = append(sorted, entrymap[f])
+		}
+		entries = sorted
+	}
+	encoder := json.NewEncoder(w)
+	n := 0
+	for _, e := range entries {
+		if !files[e.filename] {
+			continue
+		}
+		if opts.limit > 0 && n == opts.limit {
+			break
+		}
+		row := JSONEntry{Filename: e.filename, Date: FormatDate(e.date), Tags: append([]string{}, e.tags...)}
+		if content {
+			body := ParseBody(&e.content)
+			row.Content = &body
+		}
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+		n++
+	}
+	return nil
+}
+
+// prints the collection of files as aligned columns of file, date and comma
+// joined tags, under a header row. ordered as Print would.
+func PrintTable(w io.Writer, collection map[string]Set, entries []Entry, opts PrintOptions) {
+	entrymap := EntryMap(entries)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tDATE\tTAGS")
+	for _, f := range OrderFiles(entries, collection["files"], opts) {
+		e := entrymap[f]
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", f, FormatDate(e.date), strings.Join(e.tags, ","))
+	}
+	tw.Flush()
+}
+
+// prints the whole content of each file, joined by the separator. ordered as
+// Print would.
+func PrintCat(w io.Writer, collection map[string]Set, entries []Entry, separator string, opts PrintOptions) {
+	entrymap := EntryMap(entries)
+	for i, f := range OrderFiles(entries, collection["files"], opts) {
+		if i > 0 {
+			fmt.Fprint(w, separator)
+		}
+		fmt.Fprint(w, entrymap[f].content)
+	}
+}
+
+// prints the whole tagmap as JSON, mapping each tag to its sorted filenames. keys
+// are sorted too, so the output is stable for diffing.
+func PrintTagmap(w io.Writer, tagmap map[string]Set) error {
+	dump := map[string][]string{}
+	for tag, files := range tagmap {
+		dump[tag] = files.Members()
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(dump)
+}
+
+// prints the count of files in each bucket of dates, in chronological order.
+func PrintByDate(w io.Writer, counts map[string]int) {
+	fmt.Fprintln(w, "[dates]")
+	// formatted dates sort chronologically, and unknown after them:
+	for _, d := range slices.Sorted(maps.Keys(counts)) {
+		fmt.Fprintln(w, d, "=", counts[d])
+	}
+}
+
+// formats a weight to at most two decimals, so that whole counts print as such.
+func FormatWeight(weight float64) string {
+	return strconv.FormatFloat(math.Round(weight*100)/100, 'f', -1, 64)
+}
+
+// prints the first n pairs of tags with their weights.
+func PrintPairs(w io.Writer, pairs []Pair, n int) {
+	for i, p := range pairs {
+		if i == n {
+			break
+		}
+		fmt.Fprintf(w, "%s -- %s : %s\n", p.a, p.b, FormatWeight(p.weight))
+	}
+}
+
+// prints each cluster of tags as its own numbered section, in the same TOML
+// syntax as Print.
+func PrintClusters(w io.Writer, clusters [][]string) {
+	for i, cluster := range clusters {
+		fmt.Fprintf(w, "[clusters.%d]\n", i+1)
+		for _, tag := range cluster {
+			fmt.Fprintln(w, tag)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// prints the adjacency graph of the files as Graphviz DOT: each of their tags a
+// node, and each pair of tags sharing a file an edge weighted by the number of
+// files shared. nodes are in name order and edges as Pairs orders them, so the
+// output is stable.
+func PrintDOT(w io.Writer, entries []Entry, files Set) {
+	scoped := []Entry{}
+	for _, e := range entries {
+		if files[e.filename] {
+			scoped = append(scoped, e)
+		}
+	}
+	fmt.Fprintln(w, "graph gag {")
+	for _, tag := range ResultTags(entries, files) {
+		fmt.Fprintf(w, "  %q;\n", tag)
+	}
+	for _, p := range Pairs(scoped) {
+		fmt.Fprintf(w, "  %q -- %q [weight=%s];\n", p.a, p.b, FormatWeight(p.weight))
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// prints the files matching the query alongside the rest of the collection,
+// with the size of each, for checking what an --invert will show.
+func PrintAudit(w io.Writer, matched Set, complement Set) {
+	fmt.Fprintln(w, "[matched]")
+	for _, f := range matched.Members() {
+		fmt.Fprintln(w, f)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "[complement]")
+	for _, f := range complement.Members() {
+		fmt.Fprintln(w, f)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "[sums]")
+	fmt.Fprintln(w, "matched =", len(matched))
+	fmt.Fprintln(w, "complement =", len(complement))
+}
+
+// a file as represented in the search index.
+type IndexEntry struct {
+	Filename string   `json:"filename"`
+	Title    string   `json:"title"`
+	Date     string   `json:"date"`
+	Tags     []string `json:"tags"`
+	Body     string   `json:"body"`
+}
+
+// writes every entry, independent of any query, as a JSON array ordered by
+// filename: a flat index for a client-side search box to load whole.
+func ExportIndex(w io.Writer, entries []Entry) error {
+	index := []IndexEntry{}
+	for _, e := range entries {
+		index = append(index, IndexEntry{
+			Filename: e.filename,
+			Title:    ParseTitle(&e.content),
+			Date:     FormatDate(e.date),
+			Tags:     append([]string{}, e.tags...),
+			Body:     ParseBody(&e.content),
+		})
+	}
+	slices.SortFunc(index, func(a, b IndexEntry) int {
+		return strings.Compare(a.Filename, b.Filename)
+	})
+	return json.NewEncoder(w).Encode(index)
+}
+
+// an RSS 2.0 feed, as encoded by encoding/xml.
+type RSS struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel RSSChannel `xml:"channel"`
+}
+
+type RSSChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []RSSItem `xml:"item"`
+}
+
+type RSSItem struct {
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+	GUID  string `xml:"guid"`
+	// left out for a file without a date.
+	PubDate string `xml:"pubDate,omitempty"`
+}
+
+// prints the collection of files as an RSS feed, newest first. each item takes
+// its title from the # heading, and links to the file by its path. files
+// without a date come last, with no pubDate. only the newest up to the limit of
+// opts are included.
+func PrintRSS(w io.Writer, collection map[string]Set, entries []Entry, queries Query, opts PrintOptions) error {
+	entrymap := EntryMap(entries)
+	files := collection["files"].Members()
+	slices.SortStableFunc(files, func(a, b string) int {
+		return entrymap[b].date.Compare(entrymap[a].date)
+	})
+	files = Limit(files, opts.limit)
+
+	feed := RSS{Version: "2.0", Channel: RSSChannel{
+		Title:       "gag: " + strings.Join(queries.tags, ", "),
+		Link:        ".",
+		Description: "files tagged " + strings.Join(queries.tags, ", "),
+	}}
+	for _, f := range files {
+		e := entrymap[f]
+		path := cmp.Or(e.path, f)
+		item := RSSItem{Title: cmp.Or(ParseTitle(&e.content), f), Link: path, GUID: path}
+		if !e.date.IsZero() {
+			item.PubDate = e.date.Format(time.RFC1123Z)
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, out)
+	return err
+}
+
+// prints the neighbors of each query tag as YAML, each tag mapping to a list of
+// its neighbors with their counts, strongest first. tags are in sorted order, so
+// the output is stable.
+func PrintYAML(w io.Writer, groups []Group) error {
+	adjacencies := map[string][]map[string]int{}
+	for _, g := range groups {
+		neighbors := []map[string]int{}
+		for _, tag := range SortWeights(g.weights) {
+			neighbors = append(neighbors, map[string]int{tag: g.weights[tag]})
+		}
+		adjacencies[g.tag] = neighbors
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(adjacencies); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintHTML(t *testing.T) {
+	d, _ := time.Parse("2006.01.02", "2024.09.25")
+	entries := []Entry{{filename: "<b>.md", date: d, tags: []string{"foo", "a&b"}}}
+	collection := map[string]Set{"files": {"<b>.md": true}}
+
+	var buf bytes.Buffer
+	err := PrintHTML(&buf, collection, entries, PrintOptions{})
+	assert.NoError(t, err)
+	expected := `<table>
+<tr><th>file</th><th>date</th><th>tags</th></tr>
+<tr><td>&lt;b&gt;.md</td><td>2024.09.25</td><td>foo, a&amp;b</td></tr>
+</table>
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestPrintHTMLOrder(t *testing.T) {
+	out, _ := runMain(t, "--glob", TEST_PATTERN, "--html", "--sort", "date-desc", "--limit", "2", "science")
+	expected := `<table>
+<tr><th>file</th><th>date</th><th>tags</th></tr>
+<tr><td>04.baz.md</td><td>2024.10.09</td><td>science</td></tr>
+<tr><td>02.foo.md</td><td>2024.09.25</td><td>sot, science</td></tr>
+</table>
+`
+	assert.Equal(t, expected, out)
+}
+
+func TestPrintJSON(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	tagmap := Tagmap(entries)
+	queries := ParseQuery("science")
+	collection := Collect(entries, tagmap, queries)
+	weights := SharedWeights(entries, collection["files"], collection["adjacencies"])
+
+	var buf bytes.Buffer
+	err := PrintJSON(&buf, collection, entries, queries, PrintOptions{weights: weights}, false)
+	assert.NoError(t, err)
+	expected := `{
+  "files": [
+    {
+      "filename": "02.foo.md",
+      "date": "2024.09.25",
+      "tags": [
+        "sot",
+        "science"
+      ]
+    },
+    {
+      "filename": "03.bar.md",
+      "date": "2024.09.25",
+      "tags": [
+        "sot",
+        "science"
+      ]
+    },
+    {
+      "filename": "04.baz.md",
+      "date": "2024.10.09",
+      "tags": [
+        "science"
+      ]
+    }
+  ],
+  "tags": [
+    "science"
+  ],
+  "adjacencies": {
+    "sot": 2
+  },
+  "sums": {
+    "files": 3,
+    "adjacencies": 1,
+    "words": 4
+  }
+}
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestPrintJSONL(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	files := ProcessQueries(entries, Tagmap(entries), ParseQuery("science,diff"))
+
+	var buf bytes.Buffer
+	err := PrintJSONL(&buf, entries, files, PrintOptions{sort: "name"}, false)
+	assert.NoError(t, err)
+	expected := `{"filename":"02.foo.md","date":"2024.09.25","tags":["sot","science"]}
+{"filename":"03.bar.md","date":"2024.09.25","tags":["sot","science"]}
+{"filename":"04.baz.md","date":"2024.10.09","tags":["science"]}
+{"filename":"05.quz.md","date":"2024.10.09","tags":["diff"]}
+`
+	assert.Equal(t, expected, buf.String())
+
+	// unsorted, in the order read, and cut to the limit:
+	reversed := slices.Clone(entries)
+	slices.Reverse(reversed)
+	buf.Reset()
+	err = PrintJSONL(&buf, reversed, files, PrintOptions{limit: 2}, true)
+	assert.NoError(t, err)
+	expected = `{"filename":"05.quz.md","date":"2024.10.09","tags":["diff"],"content":"Blah.\n"}
+{"filename":"04.baz.md","date":"2024.10.09","tags":["science"],"content":"Blah. Foo.\n"}
+`
+	assert.Equal(t, expected, buf.String())
+
+	out, _ := runMain(t, "--glob", TEST_PATTERN, "--jsonl", "--sort", "date-desc", "diff")
+	assert.Equal(t, `{"filename":"05.quz.md","date":"2024.10.09","tags":["diff"]}`+"\n", out)
+}
+
+func TestPrintJSONContent(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("diff")
+	collection := Collect(entries, Tagmap(entries), queries)
+
+	var buf bytes.Buffer
+	err := PrintJSON(&buf, collection, entries, queries, PrintOptions{}, true)
+	assert.NoError(t, err)
+	expected := `{
+  "files": [
+    {
+      "filename": "05.quz.md",
+      "date": "2024.10.09",
+      "tags": [
+        "diff"
+      ],
+      "content": "Blah.\n"
+    }
+  ],
+  "tags": [
+    "diff"
+  ],
+  "adjacencies": {},
+  "sums": {
+    "files": 1,
+    "adjacencies": 0,
+    "words": 1
+  }
+}
+`
+	assert.Equal(t, expected, buf.String())
+
+	buf.Reset()
+	err = PrintJSON(&buf, collection, entries, queries, PrintOptions{}, false)
+	assert.NoError(t, err)
+	assert.NotContains(t, buf.String(), "content")
+}
+
+func TestPrintJSONOrder(t *testing.T) {
+	out, _ := runMain(t, "--glob", TEST_PATTERN, "--json", "--sort", "date-desc", "--limit", "1", "science")
+	expected := `{
+  "files": [
+    {
+      "filename": "04.baz.md",
+      "date": "2024.10.09",
+      "tags": [
+        "science"
+      ]
+    }
+  ],
+  "tags": [
+    "science"
+  ],
+  "adjacencies": {
+    "sot": 2
+  },
+  "sums": {
+    "files": 3,
+    "shown": 1,
+    "adjacencies": 1,
+    "words": 4
+  }
+}
+`
+	assert.Equal(t, expected, out)
+}
+
+func TestPrintTable(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("science")
+	collection := Collect(entries, Tagmap(entries), queries)
+
+	var buf bytes.Buffer
+	PrintTable(&buf, collection, entries, PrintOptions{})
+	expected := `FILE       DATE        TAGS
+02.foo.md  2024.09.25  sot,science
+03.bar.md  2024.09.25  sot,science
+04.baz.md  2024.10.09  science
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestPrintCat(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("science")
+	collection := Collect(entries, Tagmap(entries), queries)
+
+	var buf bytes.Buffer
+	PrintCat(&buf, collection, entries, "\n---\n", PrintOptions{})
+	expected := "# 02.foo.md\n: 2024.09.25\n+ sot\n+ science\n\nFoo.\n" +
+		"\n---\n" +
+		"# 03.bar.md\n: 2024.09.25\n+ sot\n+ science\n\nBar.\n" +
+		"\n---\n" +
+		"# 04.baz.md\n: 2024.10.09\n+ science\n\nBlah. Foo.\n"
+	assert.Equal(t, expected, buf.String())
+
+	// with the default separator, and filtered like any other output:
+	out, _ := runMain(t, "--glob", TEST_PATTERN, "--cat", "--invert", "--date", "2024.10", "science")
+	assert.Equal(t, "# 05.quz.md\n: 2024.10.09\n+ diff\n\nBlah.\n", out)
+	out, _ = runMain(t, "--glob", TEST_PATTERN, "--cat", "--lazy", "foo,diff")
+	assert.Equal(t, "# 01.foo.md\n: 2024.09.25\n+ sot\n+ foo\n\nFoo bar.\n\n\n# 05.quz.md\n: 2024.10.09\n+ diff\n\nBlah.\n", out)
+}
+
+func TestPrintTagmap(t *testing.T) {
+	tagmap := Tagmap(mockEntries(t, TEST_PATTERN))
+
+	var buf bytes.Buffer
+	assert.NoError(t, PrintTagmap(&buf, tagmap))
+	expected := `{
+  "diff": [
+    "05.quz.md"
+  ],
+  "foo": [
+    "01.foo.md"
+  ],
+  "science": [
+    "02.foo.md",
+    "03.bar.md",
+    "04.baz.md"
+  ],
+  "sot": [
+    "01.foo.md",
+    "02.foo.md",
+    "03.bar.md"
+  ]
+}
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestClusters(t *testing.T) {
+	entries := mockEntries(t, "./mock/clusters/*.md")
+	// bread links cooking to sourdough, and math physics to logic:
+	expected := [][]string{{"bread", "cooking", "sourdough"}, {"logic", "math", "physics"}}
+	assert.Equal(t, expected, Clusters(Adjacencies(entries)))
+
+	// a tag alone in its files is a cluster of its own:
+	entries = mockEntries(t, TEST_PATTERN)
+	expected = [][]string{{"diff"}, {"foo", "science", "sot"}}
+	assert.Equal(t, expected, Clusters(Adjacencies(entries)))
+
+	out, _ := runMain(t, "--glob", "mock/clusters/*.md", "--clusters")
+	assert.Equal(t, "[clusters.1]\nbread\ncooking\nsourdough\n\n[clusters.2]\nlogic\nmath\nphysics\n\n", out)
+}
+
+func TestPrintPairs(t *testing.T) {
+	pairs := Pairs(mockEntries(t, TEST_PATTERN))
+	expected := []Pair{{"science", "sot", 2}, {"foo", "sot", 1}}
+	assert.Equal(t, expected, pairs)
+
+	var buf bytes.Buffer
+	PrintPairs(&buf, pairs, 1)
+	assert.Equal(t, "science -- sot : 2\n", buf.String())
+}
+
+func TestPrintAudit(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	matched := ProcessQueries(entries, Tagmap(entries), ParseQuery("sot"))
+
+	var buf bytes.Buffer
+	PrintAudit(&buf, matched, Invert(entries, matched))
+	expected := `[matched]
+01.foo.md
+02.foo.md
+03.bar.md
+
+[complement]
+04.baz.md
+05.quz.md
+06.quz.md
+
+[sums]
+matched = 3
+complement = 3
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestExportIndex(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+
+	var buf bytes.Buffer
+	assert.NoError(t, ExportIndex(&buf, entries))
+	index := []IndexEntry{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &index))
+
+	assert.Len(t, index, 6)
+	expected := IndexEntry{
+		Filename: "01.foo.md",
+		Title:    "01.foo.md",
+		Date:     "2024.09.25",
+		Tags:     []string{"sot", "foo"},
+		Body:     "Foo bar.\n",
+	}
+	assert.Equal(t, expected, index[0])
+	// untagged files are still indexed:
+	assert.Equal(t, []string{}, index[5].Tags)
+	assert.Equal(t, "Diff.\n", index[5].Body)
+}
+
+func TestIDFWeight(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	pairs := Pairs(entries)
+	weighted := IDFWeight(pairs, Tagmap(entries), len(entries))
+
+	// raw, science and sot share the most files:
+	var buf bytes.Buffer
+	PrintPairs(&buf, pairs, 2)
+	assert.Equal(t, "science -- sot : 2\nfoo -- sot : 1\n", buf.String())
+
+	// but foo is rarer than either:
+	buf.Reset()
+	PrintPairs(&buf, weighted, 2)
+	assert.Equal(t, "foo -- sot : 1.24\nscience -- sot : 0.96\n", buf.String())
+}
+
+func TestPrintRSS(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("science")
+	collection := Collect(entries, Tagmap(entries), queries)
+
+	var buf bytes.Buffer
+	assert.NoError(t, PrintRSS(&buf, collection, entries, queries, PrintOptions{}))
+	assert.True(t, strings.HasPrefix(buf.String(), xml.Header))
+
+	feed := RSS{}
+	assert.NoError(t, xml.Unmarshal(buf.Bytes(), &feed))
+	assert.Equal(t, "2.0", feed.Version)
+	assert.Equal(t, "gag: science", feed.Channel.Title)
+	expected := []RSSItem{
+		{"04.baz.md", "mock/04.baz.md", "mock/04.baz.md", "Wed, 09 Oct 2024 00:00:00 +0000"},
+		{"02.foo.md", "mock/02.foo.md", "mock/02.foo.md", "Wed, 25 Sep 2024 00:00:00 +0000"},
+		{"03.bar.md", "mock/03.bar.md", "mock/03.bar.md", "Wed, 25 Sep 2024 00:00:00 +0000"},
+	}
+	assert.Equal(t, expected, feed.Channel.Items)
+}
+
+func TestPrintRSSLimit(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("science")
+	collection := Collect(entries, Tagmap(entries), queries)
+
+	// only the newest:
+	var buf bytes.Buffer
+	assert.NoError(t, PrintRSS(&buf, collection, entries, queries, PrintOptions{limit: 1}))
+	feed := RSS{}
+	assert.NoError(t, xml.Unmarshal(buf.Bytes(), &feed))
+	assert.Len(t, feed.Channel.Items, 1)
+	assert.Equal(t, "04.baz.md", feed.Channel.Items[0].Title)
+
+	out, _ := runMain(t, "--glob", TEST_PATTERN, "--rss", "--limit", "1", "science")
+	assert.Equal(t, buf.String(), out)
+}
+
+func TestPrintRSSUndated(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("diff")
+	// 06.quz.md has no date that parses:
+	collection := map[string]Set{"files": {"05.quz.md": true, "06.quz.md": true}}
+
+	var buf bytes.Buffer
+	assert.NoError(t, PrintRSS(&buf, collection, entries, queries, PrintOptions{}))
+	assert.NotContains(t, buf.String(), "0001")
+	feed := RSS{}
+	assert.NoError(t, xml.Unmarshal(buf.Bytes(), &feed))
+	expected := []RSSItem{
+		{"05.quz.md", "mock/05.quz.md", "mock/05.quz.md", "Wed, 09 Oct 2024 00:00:00 +0000"},
+		{"06.quz.md", "mock/06.quz.md", "mock/06.quz.md", ""},
+	}
+	assert.Equal(t, expected, feed.Channel.Items)
+	assert.Equal(t, 1, strings.Count(buf.String(), "<pubDate>"))
+}
+
+func TestPrintYAML(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("sot,science")
+	groups := GroupAdjacencies(Tagmap(entries), Adjacencies(entries), queries)
+
+	var buf bytes.Buffer
+	assert.NoError(t, PrintYAML(&buf, groups))
+	expected := `science:
+  - sot: 2
+sot:
+  - science: 2
+  - foo: 1
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestPrintDOT(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	files := ProcessQueries(entries, Tagmap(entries), ParseQuery("sot"))
+
+	var buf bytes.Buffer
+	PrintDOT(&buf, entries, files)
+	expected := `graph gag {
+  "foo";
+  "science";
+  "sot";
+  "science" -- "sot" [weight=2];
+  "foo" -- "sot" [weight=1];
+}
+`
+	assert.Equal(t, expected, buf.String())
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// times the phases of a run, printing each as it ends. a nil Profiler does
+// nothing, so callers needn't check whether profiling is on.
+type Profiler struct {
+	w    io.Writer
+	last time.Time
+}
+
+func NewProfiler(w io.Writer) *Profiler {
+	return &Profiler{w, time.Now()}
+}
+
+// prints the time spent in the phase which just ended, since the previous mark.
+func (p *Profiler) Mark(phase string) {
+	if p == nil {
+		return
+	}
+	now := time.Now()
+	fmt.Fprintf(p.w, "profile: %-11s %v\n", phase, now.Sub(p.last))
+	p.last = now
+}
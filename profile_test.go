@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfilerMark(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewProfiler(&buf)
+	p.Mark("glob")
+	p.Mark("read")
+	assert.Regexp(t, `^profile: glob +\S+\nprofile: read +\S+\n$`, buf.String())
+
+	// a nil profiler is off:
+	var off *Profiler
+	assert.NotPanics(t, func() { off.Mark("glob") })
+}
+
+// runs main with the args, returning what it wrote to stdout and stderr.
+func runMain(t *testing.T, args ...string) (string, string) {
+	dir := t.TempDir()
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	assert.NoError(t, err)
+	stderr, err := os.Create(filepath.Join(dir, "stderr"))
+	assert.NoError(t, err)
+	stdin, err := os.Open(os.DevNull)
+	assert.NoError(t, err)
+
+	oldArgs, oldStdin, oldStdout, oldStderr, oldWarnings, oldHome := os.Args, os.Stdin, os.Stdout, os.Stderr, warnings, home
+	defer func() {
+		os.Args, os.Stdin, os.Stdout, os.Stderr, warnings, home = oldArgs, oldStdin, oldStdout, oldStderr, oldWarnings, oldHome
+	}()
+	// never the .gagrc or the query of whoever runs the tests:
+	home = func() (string, error) { return dir, nil }
+	t.Setenv(QUERY_ENV, "")
+	os.Args = append([]string{"gag"}, args...)
+	os.Stdin, os.Stdout, os.Stderr, warnings = stdin, stdout, stderr, stderr
+	flag.CommandLine = flag.NewFlagSet("gag", flag.ExitOnError)
+	main()
+
+	out, err := os.ReadFile(stdout.Name())
+	assert.NoError(t, err)
+	errs, err := os.ReadFile(stderr.Name())
+	assert.NoError(t, err)
+	return string(out), string(errs)
+}
+
+func TestProfile(t *testing.T) {
+	out, errs := runMain(t, "--profile", "--pipe", "--glob", TEST_PATTERN, "science")
+
+	assert.Equal(t, "02.foo.md\n03.bar.md\n04.baz.md\n\n", out)
+	for _, phase := range []string{"glob", "read", "tagmap", "adjacencies", "query", "print"} {
+		assert.Regexp(t, `(?m)^profile: `+phase+` +\S+$`, errs)
+	}
+}
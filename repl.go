@@ -0,0 +1,23 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// reads queries line by line, calling search with each as parsed by parse,
+// until an empty line or the end of input. whatever was parsed before the
+// session is kept in memory by search, so that only the first query pays for
+// reading the files.
+func Repl(r io.Reader, w io.Writer, parse func(string) Query, search func(w io.Writer, queries Query)) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			break
+		}
+		search(w, parse(line))
+	}
+	return scanner.Err()
+}
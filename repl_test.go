@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepl(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	tagmap := Tagmap(entries)
+	search := func(w io.Writer, queries Query) {
+		Print(w, entries, Collect(entries, tagmap, queries), queries, PrintOptions{pipe: true})
+	}
+
+	var buf bytes.Buffer
+	input := "science\nsot+science\n\nfoo\n"
+	assert.NoError(t, Repl(strings.NewReader(input), &buf, ParseQuery, search))
+	// the query after the empty line is never run:
+	expected := "02.foo.md\n03.bar.md\n04.baz.md\n\n" +
+		"02.foo.md\n03.bar.md\n\n"
+	assert.Equal(t, expected, buf.String())
+}
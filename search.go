@@ -0,0 +1,196 @@
+package main
+
+import (
+	"maps"
+	"slices"
+)
+
+// settings for Search. the zero value finds the files matching the query by
+// their tags alone.
+type SearchOptions struct {
+	// a query tag also matches its subtags, nested by TAG_SEPARATOR.
+	prefix bool
+	// also match files containing the query as content.
+	grep bool
+	// also match files containing the query as filename.
+	find bool
+	// omit files containing the query as tag.
+	diff bool
+	// keep the files not matching the query instead.
+	invert bool
+	// keep only files carrying any tag at all, before invert, so that both
+	// together find the untagged files.
+	hastags bool
+	// drop the files carrying any of these tags, whatever the query, and after
+	// invert.
+	not []string
+	// keep only tags adjacent to every query tag.
+	common bool
+	// keep only adjacent tags sharing at least this many files with the query
+	// tags. 0 or 1 keeps every one.
+	minadjacency int
+	// EXPERIMENTAL: widen the files to all those carrying every tag the matched
+	// files share.
+	superset bool
+	// keep only files where the query tag is the only tag.
+	orphans bool
+	// keep only files dated within this date or range, as for Date.
+	date string
+	// keep only files dated on or after since, and on or before until, as for
+	// Between.
+	since string
+	until string
+	// for date, since, until and recent, fall back to the modification time of
+	// files without a date.
+	mtime bool
+	// keep only the newest percent of files, as for Recent.
+	recent float64
+	// keep only files satisfying this comparison, as for Numeric.
+	priority string
+	// keep only files whose name contains this, or matches it as a glob, as for
+	// Name.
+	name string
+}
+
+// the tagmap and adjacencies the query is matched against, as changed by the
+// options. the given tagmap is left alone, so that it may be reused.
+func SearchTagmap(
+	entries []Entry,
+	tagmap map[string]Set,
+	adjacencies map[string]Set,
+	queries Query,
+	opts SearchOptions,
+) (map[string]Set, map[string]Set) {
+	tagmap = CloneTagmap(tagmap)
+	if opts.prefix {
+		tagmap, adjacencies = Hierarchy(tagmap, adjacencies)
+	}
+	if opts.grep {
+		tagmap = Grep(entries, tagmap, queries)
+	}
+	if opts.find {
+		tagmap = Find(entries, tagmap, queries)
+	}
+	if opts.diff {
+		tagmap = Diff(entries, tagmap, queries)
+	}
+	return tagmap, adjacencies
+}
+
+// collects the files of the query as Collect, narrows them by the options, and
+// only then finds the tags adjacent to those left.
+func Filter(
+	entries []Entry,
+	tagmap map[string]Set,
+	adjacencies map[string]Set,
+	queries Query,
+	opts SearchOptions,
+) (map[string]Set, error) {
+	files := ProcessQueries(entries, tagmap, queries)
+	if opts.hastags {
+		files = files.Intersect(HasTags(entries))
+	}
+	if opts.invert {
+		files = Invert(entries, files)
+	}
+	for _, tag := range opts.not {
+		files = files.Difference(MatchFiles(tagmap, tag))
+	}
+	if opts.superset {
+		files = Superset(entries, files)
+	}
+	if opts.orphans {
+		files = Orphans(entries, tagmap, files, queries)
+	}
+	var err error
+	dated := entries
+	if opts.mtime {
+		dated = MtimeDates(entries)
+	}
+	if opts.date != "" {
+		if files, err = Date(dated, files, opts.date); err != nil {
+			return nil, err
+		}
+	}
+	if opts.since != "" || opts.until != "" {
+		if files, err = Between(dated, files, opts.since, opts.until); err != nil {
+			return nil, err
+		}
+	}
+	if opts.recent != 0 {
+		if files, err = Recent(dated, files, opts.recent); err != nil {
+			return nil, err
+		}
+	}
+	if opts.priority != "" {
+		if files, err = Numeric(entries, files, opts.priority); err != nil {
+			return nil, err
+		}
+	}
+	if opts.name != "" {
+		if files, err = Name(files, opts.name); err != nil {
+			return nil, err
+		}
+	}
+	// the adjacencies of the files left after every filter, as Collect would
+	// find for them. inverted, those files aren't what the query tags share, so
+	// every one of their tags is a neighbor:
+	neighbors := queries
+	if opts.invert {
+		neighbors = Query{}
+	}
+	collection := map[string]Set{
+		"files":       files,
+		"adjacencies": ReduceAdjacencies(entries, tagmap, files, neighbors),
+	}
+	if opts.common {
+		// only those the files left still carry:
+		common := CommonAdjacencies(adjacencies, queries)
+		collection["adjacencies"] = common.Intersect(collection["adjacencies"])
+	}
+	if opts.minadjacency > 1 {
+		// by the matched files each neighbor is on, not its weights summed over
+		// the query tags, which would count a file carrying two of them twice:
+		weights := SharedWeights(entries, files, collection["adjacencies"])
+		collection["adjacencies"] = MinAdjacency(collection["adjacencies"], weights, opts.minadjacency)
+	}
+	return collection, nil
+}
+
+// the whole query engine in one call: the files matching the query, and each of
+// their adjacent tags mapped to the matched files carrying it. the error is that
+// of an option which doesn't parse, such as a malformed date.
+//
+// still part of package main, for main and the tests: another program can't
+// build its arguments until the engine moves into a package of its own.
+func Search(entries []Entry, queries Query, opts SearchOptions) (Set, map[string]Set, error) {
+	return SearchMaps(entries, Tagmap(entries), Adjacencies(entries), queries, opts)
+}
+
+// as Search, over a tagmap and adjacencies already built, which a repl reuses
+// across queries. neither is modified.
+func SearchMaps(
+	entries []Entry,
+	tagmap map[string]Set,
+	adjacencies map[string]Set,
+	queries Query,
+	opts SearchOptions,
+) (Set, map[string]Set, error) {
+	tagmap, adjacencies = SearchTagmap(entries, tagmap, adjacencies, queries, opts)
+	WarnUnknown(tagmap, queries)
+	collection, err := Filter(entries, tagmap, adjacencies, queries, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	files := collection["files"]
+	return files, TagFiles(entries, files, collection["adjacencies"]), nil
+}
+
+// the collection of files and adjacencies Print takes, from the results of
+// Search.
+func SearchCollection(files Set, neighbors map[string]Set) map[string]Set {
+	return map[string]Set{
+		"files":       files,
+		"adjacencies": ToSet(slices.Collect(maps.Keys(neighbors))),
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearch(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("science")
+	files, neighbors, err := Search(entries, queries, SearchOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Set{"sot": {"02.foo.md": true, "03.bar.md": true}}, neighbors)
+
+	// the same as TestPrint, which collects by hand:
+	var buf bytes.Buffer
+	Print(&buf, entries, SearchCollection(files, neighbors), queries, PrintOptions{})
+	expected := `[files]
+02.foo.md
+03.bar.md
+04.baz.md
+
+[tags]
+science
+
+[adjacencies]
+sot
+
+[sums]
+files       = 3
+adjacencies = 1
+words       = 4
+
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestSearchOptions(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("science")
+	files, _, err := Search(entries, queries, SearchOptions{invert: true})
+	assert.NoError(t, err)
+	assert.Equal(t, Invert(entries, ProcessQueries(entries, Tagmap(entries), queries)), files)
+
+	_, _, err = Search(entries, queries, SearchOptions{date: "not a date"})
+	assert.Error(t, err)
+}
+
+func TestSearchTagmapCopies(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	tagmap := Tagmap(entries)
+	before := CloneTagmap(tagmap)
+	SearchTagmap(entries, tagmap, Adjacencies(entries), ParseQuery("Foo"), SearchOptions{grep: true})
+	assert.Equal(t, before, tagmap)
+}
+
+func TestSearchMinAdjacency(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("sot")
+
+	// foo shares only 01.foo.md with sot, where science shares two:
+	_, neighbors, err := Search(entries, queries, SearchOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo", "science"}, slices.Sorted(maps.Keys(neighbors)))
+	files, neighbors, err := Search(entries, queries, SearchOptions{minadjacency: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"science"}, slices.Sorted(maps.Keys(neighbors)))
+	// the files are untouched:
+	assert.Len(t, files, 3)
+}
+
+func TestSearchCommon(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("sot")
+
+	_, neighbors, err := Search(entries, queries, SearchOptions{common: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo", "science"}, slices.Sorted(maps.Keys(neighbors)))
+
+	// once filtered, only the neighbors of the files left, which lack foo:
+	_, neighbors, err = Search(entries, queries, SearchOptions{common: true, invert: true})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Set{"science": {"04.baz.md": true}}, neighbors)
+	_, neighbors, err = Search(entries, queries, SearchOptions{common: true, date: "2024.10"})
+	assert.NoError(t, err)
+	assert.Empty(t, neighbors)
+}
+
+func TestSearchMinAdjacencyDistinct(t *testing.T) {
+	entries := mockEntries(t, "./mock/adjacency/*.md")
+	queries := ParseQuery("cooking,bread")
+
+	// flour is on 01.both.md alone, which carries both query tags, so it shares
+	// a single file however many of them it's adjacent to. salt shares two:
+	_, neighbors, err := Search(entries, queries, SearchOptions{minadjacency: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bread", "cooking", "salt"}, slices.Sorted(maps.Keys(neighbors)))
+	assert.Equal(t, Set{"02.cooking.md": true, "03.bread.md": true}, neighbors["salt"])
+}
+
+func TestSearchName(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("sot,science")
+
+	files, _, err := Search(entries, queries, SearchOptions{name: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"01.foo.md", "02.foo.md"}, files.Members())
+
+	// as a glob, after the date:
+	files, _, err = Search(entries, queries, SearchOptions{name: "0?.ba*", date: "2024.10"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"04.baz.md"}, files.Members())
+
+	_, _, err = Search(entries, queries, SearchOptions{name: "[foo"})
+	assert.ErrorContains(t, err, "bad --name glob")
+}
+
+func TestSearchNot(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	queries := ParseQuery("sot,science")
+
+	files, _, err := Search(entries, queries, SearchOptions{not: []string{"foo", "sot"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"04.baz.md"}, files.Members())
+
+	// after invert too:
+	files, _, err = Search(entries, queries, SearchOptions{invert: true, not: []string{"diff"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"06.quz.md"}, files.Members())
+
+	out, _ := runMain(t, "--glob", TEST_PATTERN, "--pipe", "--not", "foo", "--not", "sot", "sot,science")
+	assert.Equal(t, "04.baz.md\n\n", out)
+}
+
+func TestSearchHasTags(t *testing.T) {
+	entries := mockEntries(t, TEST_PATTERN)
+	everything := Query{groups: [][]string{{}}, negated: [][]string{{}}}
+
+	files, _, err := Search(entries, everything, SearchOptions{hastags: true})
+	assert.NoError(t, err)
+	expected := []string{"01.foo.md", "02.foo.md", "03.bar.md", "04.baz.md", "05.quz.md"}
+	assert.Equal(t, expected, files.Members())
+
+	// only the untagged file lacks them:
+	files, _, err = Search(entries, everything, SearchOptions{hastags: true, invert: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"06.quz.md"}, files.Members())
+
+	out, _ := runMain(t, "--glob", TEST_PATTERN, "--pipe", "--has-tags", "--invert")
+	assert.Equal(t, "06.quz.md\n\n", out)
+	out, _ = runMain(t, "--glob", TEST_PATTERN, "--pipe", "--has-tags", "diff")
+	assert.Equal(t, "05.quz.md\n\n", out)
+}
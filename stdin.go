@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// whether something is piped to stdin, rather than it being a terminal.
+func isStdinLoaded() bool {
+	stat, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice == 0
+}
+
+// parses a list of files, either one per line, or as a JSON array of strings as
+// emitted by jq and the like.
+func ParseFilelist(input string) ([]string, error) {
+	input = strings.TrimSpace(input)
+	files := []string{}
+	if strings.HasPrefix(input, "[") {
+		err := json.Unmarshal([]byte(input), &files)
+		return files, err
+	}
+	for _, line := range strings.Split(input, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
+
+// reads the list of files piped to stdin.
+func GetStdin(r io.Reader) ([]string, error) {
+	dat, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	files, err := ParseFilelist(string(dat))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the files on stdin: %w", err)
+	}
+	return files, nil
+}
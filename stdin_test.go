@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetStdinLines(t *testing.T) {
+	files, err := GetStdin(strings.NewReader("mock/01.foo.md\n\nmock/04.baz.md\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mock/01.foo.md", "mock/04.baz.md"}, files)
+}
+
+func TestGetStdinJSON(t *testing.T) {
+	input := `  ["mock/01.foo.md", "mock/04.baz.md"]` + "\n"
+	files, err := GetStdin(strings.NewReader(input))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mock/01.foo.md", "mock/04.baz.md"}, files)
+
+	entries, err := ReadEntries(files, ReadOptions{})
+	assert.NoError(t, err)
+	tagmap := Tagmap(entries)
+	assert.Equal(t, Set{"01.foo.md": true, "04.baz.md": true}, ProcessQueries(entries, tagmap, ParseQuery("foo,science")))
+}
+
+func TestParseFilelistBadJSON(t *testing.T) {
+	_, err := ParseFilelist(`["mock/01.foo.md",`)
+	assert.Error(t, err)
+}
+
+// a reader which always fails, like a closed pipe.
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestGetStdinReadError(t *testing.T) {
+	files, err := GetStdin(failingReader{})
+	assert.ErrorContains(t, err, "broken pipe")
+	assert.Nil(t, files)
+
+	_, err = GetStdin(strings.NewReader(`["mock/01.foo.md",`))
+	assert.ErrorContains(t, err, "failed to parse the files on stdin")
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// the edit distance between two strings: the fewest insertions, deletions and
+// substitutions of characters turning one into the other.
+func Levenshtein(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	// only the previous row of the table is needed:
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
+
+// clusters tags lying within the edit distance of one another, transitively,
+// as candidate near-duplicates to merge: science and scince, todo and todos.
+// tags without a close neighbor are left out.
+//
+// each cluster is ordered by file count descending and then by name, so the
+// likely canonical spelling comes first, and clusters by their first tag.
+func Typos(tagmap map[string]Set, distance int) (clusters [][]string) {
+	tags := slices.Sorted(maps.Keys(tagmap))
+
+	// union-find over the indices of tags:
+	parent := make([]int, len(tags))
+	for i := range parent {
+		parent[i] = i
+	}
+	var root func(i int) int
+	root = func(i int) int {
+		if parent[i] != i {
+			parent[i] = root(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range tags {
+		for j := i + 1; j < len(tags); j++ {
+			if Levenshtein(tags[i], tags[j]) <= distance {
+				parent[root(j)] = root(i)
+			}
+		}
+	}
+
+	members := map[int][]string{}
+	for i, tag := range tags {
+		members[root(i)] = append(members[root(i)], tag)
+	}
+	for _, cluster := range members {
+		if len(cluster) < 2 {
+			continue
+		}
+		slices.SortFunc(cluster, func(a, b string) int {
+			if c := len(tagmap[b]) - len(tagmap[a]); c != 0 {
+				return c
+			}
+			return strings.Compare(a, b)
+		})
+		clusters = append(clusters, cluster)
+	}
+	slices.SortFunc(clusters, func(a, b []string) int {
+		return strings.Compare(a[0], b[0])
+	})
+	return clusters
+}
+
+// prints each cluster of near-duplicate tags on a line, with their file counts.
+func PrintTypos(w io.Writer, tagmap map[string]Set, clusters [][]string) {
+	fmt.Fprintln(w, "[typos]")
+	for _, cluster := range clusters {
+		counted := []string{}
+		for _, tag := range cluster {
+			counted = append(counted, fmt.Sprintf("%s (%d)", tag, len(tagmap[tag])))
+		}
+		fmt.Fprintln(w, strings.Join(counted, ", "))
+	}
+}
+
+// the largest edit distance at which a missing query tag is still likely a typo
+// of an existing one.
+const SUGGEST_DISTANCE = 2
+
+// the tags of the map nearest to the given tag, within the edit distance, most
+// used first. nothing is near enough when as many edits would rewrite the whole
+// tag, so a short tag never suggests every other.
+func Suggest(tagmap map[string]Set, tag string, distance int) []string {
+	best := distance + 1
+	near := []string{}
+	for other := range tagmap {
+		d := Levenshtein(tag, other)
+		if d >= len([]rune(tag)) || d > best {
+			continue
+		}
+		if d < best {
+			best, near = d, []string{}
+		}
+		near = append(near, other)
+	}
+	slices.SortFunc(near, func(a, b string) int {
+		if c := len(tagmap[b]) - len(tagmap[a]); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	return near
+}
+
+// warns of each plain query tag no file carries, with the tags it may be a typo
+// of. wildcards and regular expressions are left alone.
+func WarnUnknown(tagmap map[string]Set, queries Query) {
+	for _, tag := range queries.tags {
+		if _, ok := tagmap[tag]; ok {
+			continue
+		}
+		if pattern, err := TagPattern(tag); pattern != nil || err != nil {
+			continue
+		}
+		if near := Suggest(tagmap, tag, SUGGEST_DISTANCE); len(near) > 0 {
+			Warnf("no files are tagged %s, did you mean: %s?", tag, strings.Join(near, ", "))
+		}
+	}
+}
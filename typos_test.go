@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevenshtein(t *testing.T) {
+	assert.Equal(t, 0, Levenshtein("science", "science"))
+	assert.Equal(t, 1, Levenshtein("science", "scince"))
+	assert.Equal(t, 1, Levenshtein("todo", "todos"))
+	assert.Equal(t, 2, Levenshtein("science", "sceince"))
+	assert.Equal(t, 3, Levenshtein("", "foo"))
+	assert.Equal(t, 1, Levenshtein("café", "cafe"))
+}
+
+func TestTypos(t *testing.T) {
+	tagmap := map[string]Set{
+		"science": {"a.md": true, "b.md": true, "c.md": true},
+		"scince":  {"d.md": true},
+		"todos":   {"a.md": true},
+		"todo":    {"b.md": true, "c.md": true},
+		"foo":     {"a.md": true},
+		"bar":     {"b.md": true},
+	}
+	clusters := Typos(tagmap, 1)
+	expected := [][]string{{"science", "scince"}, {"todo", "todos"}}
+	assert.Equal(t, expected, clusters)
+
+	var buf bytes.Buffer
+	PrintTypos(&buf, tagmap, clusters)
+	assert.Equal(t, "[typos]\nscience (3), scince (1)\ntodo (2), todos (1)\n", buf.String())
+}
+
+func TestSuggest(t *testing.T) {
+	tagmap := Tagmap(mockEntries(t, TEST_PATTERN))
+	assert.Equal(t, []string{"science"}, Suggest(tagmap, "sceince", SUGGEST_DISTANCE))
+	assert.Equal(t, []string{"sot"}, Suggest(tagmap, "sott", SUGGEST_DISTANCE))
+	assert.Equal(t, []string{"foo"}, Suggest(tagmap, "fo", SUGGEST_DISTANCE))
+	// too far from anything, or too short to say:
+	assert.Empty(t, Suggest(tagmap, "philosophy", SUGGEST_DISTANCE))
+	assert.Empty(t, Suggest(tagmap, "xy", SUGGEST_DISTANCE))
+}
+
+func TestWarnUnknown(t *testing.T) {
+	tagmap := Tagmap(mockEntries(t, TEST_PATTERN))
+	var stderr bytes.Buffer
+	warnings = &stderr
+	defer func() { warnings = os.Stderr }()
+
+	WarnUnknown(tagmap, ParseQuery("sceince,foo,philosophy,sc*"))
+	assert.Equal(t, "warning: no files are tagged sceince, did you mean: science?\n", stderr.String())
+}
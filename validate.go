@@ -0,0 +1,64 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// tags matching this are likely parsing mistakes: leading or trailing
+// punctuation, whitespace, or a query operator inside the tag.
+const SUSPICIOUS_TAGS = `^[[:punct:]]|[[:punct:]]$|[\s,+]`
+
+// maps each tag matching the pattern to the files carrying it.
+func Suspicious(tagmap map[string]Set, pattern *regexp.Regexp) map[string]Set {
+	suspicious := map[string]Set{}
+	for tag, files := range tagmap {
+		if pattern.MatchString(tag) {
+			suspicious[tag] = files
+		}
+	}
+	return suspicious
+}
+
+// prints each suspicious tag, quoted to show any whitespace, with its files.
+func PrintSuspicious(w io.Writer, suspicious map[string]Set) {
+	fmt.Fprintln(w, "[suspicious]")
+	tags := Set{}
+	for tag, _ := range suspicious {
+		tags[tag] = true
+	}
+	for _, tag := range tags.Members() {
+		fmt.Fprintf(w, "%q = %s\n", tag, strings.Join(suspicious[tag].Members(), ", "))
+	}
+}
+
+// the files which parsed without any tags, and those without a date, which a
+// search can only ever find by grep, or never at all.
+func Malformed(entries []Entry) (untagged []string, undated []string) {
+	for _, e := range entries {
+		path := cmp.Or(e.path, e.filename)
+		if len(e.tags) == 0 {
+			untagged = append(untagged, path)
+		}
+		if e.date.IsZero() {
+			undated = append(undated, path)
+		}
+	}
+	return untagged, undated
+}
+
+// prints each malformed file, under the problem found with it.
+func PrintMalformed(w io.Writer, untagged []string, undated []string) {
+	fmt.Fprintln(w, "[untagged]")
+	for _, f := range untagged {
+		fmt.Fprintln(w, f)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "[undated]")
+	for _, f := range undated {
+		fmt.Fprintln(w, f)
+	}
+}
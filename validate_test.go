@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuspicious(t *testing.T) {
+	tagmap := Tagmap(mockEntries(t, "./mock/validate/*.md"))
+	suspicious := Suspicious(tagmap, regexp.MustCompile(SUSPICIOUS_TAGS))
+
+	var buf bytes.Buffer
+	PrintSuspicious(&buf, suspicious)
+	expected := `[suspicious]
+"fine," = 02.typo.md
+"two words" = 02.typo.md
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestSuspiciousCustom(t *testing.T) {
+	tagmap := Tagmap(mockEntries(t, "./mock/validate/*.md"))
+	suspicious := Suspicious(tagmap, regexp.MustCompile(`[A-Z]`))
+	assert.Equal(t, map[string]Set{"Fine": {"02.typo.md": true}}, suspicious)
+}
+
+func TestMalformed(t *testing.T) {
+	untagged, undated := Malformed(mockEntries(t, "./mock/strict/*.md"))
+	assert.Equal(t, []string{"mock/strict/02.untagged.md"}, untagged)
+	assert.Equal(t, []string{"mock/strict/03.undated.md"}, undated)
+
+	var buf bytes.Buffer
+	PrintMalformed(&buf, untagged, undated)
+	expected := `[untagged]
+mock/strict/02.untagged.md
+
+[undated]
+mock/strict/03.undated.md
+`
+	assert.Equal(t, expected, buf.String())
+
+	// the well formed mock files pass:
+	untagged, undated = Malformed(mockEntries(t, "./mock/strict/01.good.md"))
+	assert.Empty(t, untagged)
+	assert.Empty(t, undated)
+}
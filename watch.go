@@ -0,0 +1,106 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"time"
+)
+
+// how often the watched files are checked for changes.
+const POLL_INTERVAL = 100 * time.Millisecond
+
+// moves the cursor home and clears a terminal, before each re-run of --watch.
+const CLEAR_SCREEN = "\033[H\033[2J"
+
+// the modification times of the files listed, keyed by path. list gives the
+// files a run would read, so that excluded ones are never watched.
+func Snapshot(list func() ([]string, error)) (map[string]time.Time, error) {
+	files, err := list()
+	if err != nil {
+		return nil, err
+	}
+	snapshot := map[string]time.Time{}
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			// vanished between the glob and the stat, which the next poll will see:
+			continue
+		}
+		snapshot[f] = info.ModTime()
+	}
+	return snapshot, nil
+}
+
+// calls run once for each burst of events, where a burst ends once no further
+// event has arrived for the duration of the window. editors tend to emit
+// several writes per save, which would otherwise each trigger a run.
+//
+// returns when the events channel is closed, running any pending burst first.
+func Debounce(events <-chan struct{}, window time.Duration, run func()) {
+	// a nil channel blocks forever, so nothing fires until the first event:
+	var timer <-chan time.Time
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				if timer != nil {
+					run()
+				}
+				return
+			}
+			timer = time.After(window)
+		case <-timer:
+			timer = nil
+			run()
+		}
+	}
+}
+
+// polls the files listed every interval, and sends an event each time they've
+// changed, whether added, removed or modified. a list which fails is warned
+// about once, until it recovers, and the last good snapshot kept meanwhile.
+// stops polling and closes the channel once done is closed.
+func Changes(list func() ([]string, error), interval time.Duration, done <-chan struct{}) <-chan struct{} {
+	events := make(chan struct{})
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		failed := ""
+		last, err := Snapshot(list)
+		if err != nil {
+			Warnf("%v", err)
+			failed = err.Error()
+		}
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			current, err := Snapshot(list)
+			if err != nil {
+				if err.Error() != failed {
+					Warnf("%v", err)
+				}
+				failed = err.Error()
+				continue
+			}
+			failed = ""
+			if !maps.Equal(last, current) {
+				select {
+				case events <- struct{}{}:
+				case <-done:
+					return
+				}
+			}
+			last = current
+		}
+	}()
+	return events
+}
+
+// polls the files listed, and calls run after they change. never returns.
+func Watch(list func() ([]string, error), debounce time.Duration, run func()) {
+	Debounce(Changes(list, POLL_INTERVAL, nil), debounce, run)
+}
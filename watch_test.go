@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebounceRapidEvents(t *testing.T) {
+	events := make(chan struct{})
+	runs := 0
+	done := make(chan struct{})
+	go func() {
+		Debounce(events, time.Second, func() { runs++ })
+		close(done)
+	}()
+
+	for range 5 {
+		events <- struct{}{}
+	}
+	close(events)
+	<-done
+	assert.Equal(t, 1, runs)
+}
+
+func TestDebounceSeparateBursts(t *testing.T) {
+	events := make(chan struct{})
+	runs := 0
+	done := make(chan struct{})
+	go func() {
+		Debounce(events, 10*time.Millisecond, func() { runs++ })
+		close(done)
+	}()
+
+	events <- struct{}{}
+	events <- struct{}{}
+	time.Sleep(100 * time.Millisecond)
+	events <- struct{}{}
+	close(events)
+	<-done
+	assert.Equal(t, 2, runs)
+}
+
+func TestChanges(t *testing.T) {
+	dir := t.TempDir()
+	note := filepath.Join(dir, "note.md")
+	os.WriteFile(note, []byte("# note.md\n+ foo\n"), 0644)
+
+	done := make(chan struct{})
+	list := func() ([]string, error) { return Filelist(filepath.Join(dir, "*.md")) }
+	events := Changes(list, 10*time.Millisecond, done)
+	// let the first snapshot be taken before changing anything:
+	time.Sleep(50 * time.Millisecond)
+
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(note, later, later)
+	select {
+	case <-events:
+	case <-time.After(time.Second):
+		t.Fatal("no event after a file was modified")
+	}
+
+	os.WriteFile(filepath.Join(dir, "new.md"), []byte("# new.md\n"), 0644)
+	select {
+	case <-events:
+	case <-time.After(time.Second):
+		t.Fatal("no event after a file was added")
+	}
+
+	close(done)
+	for range events {
+	}
+}
+
+func TestSnapshotError(t *testing.T) {
+	_, err := Snapshot(func() ([]string, error) { return Filelist("mock/[*.md") })
+	assert.Error(t, err)
+}
+
+func TestChangesListError(t *testing.T) {
+	var stderr bytes.Buffer
+	warnings = &stderr
+	defer func() { warnings = os.Stderr }()
+
+	// a list which fails on every poll is warned about only once:
+	done := make(chan struct{})
+	list := func() ([]string, error) { return nil, errors.New("unreadable") }
+	events := Changes(list, 10*time.Millisecond, done)
+	time.Sleep(50 * time.Millisecond)
+	close(done)
+	for range events {
+	}
+	assert.Equal(t, "warning: unreadable\n", stderr.String())
+}
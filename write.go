@@ -0,0 +1,103 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// a change to a single line of a file. line numbers count from 1, as an editor
+// would show them.
+type Edit struct {
+	path string
+	line int
+	old  string
+	new  string
+}
+
+// formats edits as a diff-like preview, each under the path and line it changes.
+func SprintPreview(edits []Edit) string {
+	preview := ""
+	for _, e := range edits {
+		preview += fmt.Sprintf("%s:%d\n", e.path, e.line)
+		preview += fmt.Sprintln("-", e.old)
+		preview += fmt.Sprintln("+", e.new)
+	}
+	return preview
+}
+
+// appended to the path of a file to back it up before it's first edited.
+const BACKUP_SUFFIX = ".bak"
+
+// writes the edits into their files, after checking that each line still reads
+// as expected. with backup, each file is first copied aside as it was.
+func ApplyEdits(edits []Edit, backup bool) error {
+	backedup := Set{}
+	for _, e := range edits {
+		info, err := os.Stat(e.path)
+		if err != nil {
+			return err
+		}
+		dat, err := os.ReadFile(e.path)
+		if err != nil {
+			return err
+		}
+		lines := strings.Split(string(dat), "\n")
+		if e.line < 1 || e.line > len(lines) || lines[e.line-1] != e.old {
+			return fmt.Errorf("%s:%d has changed, expected %q", e.path, e.line, e.old)
+		}
+		if backup && !backedup[e.path] {
+			if err := os.WriteFile(e.path+BACKUP_SUFFIX, dat, info.Mode()); err != nil {
+				return err
+			}
+			backedup[e.path] = true
+		}
+		lines[e.line-1] = e.new
+		err = os.WriteFile(e.path, []byte(strings.Join(lines, "\n")), info.Mode())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the common path of every write operation: print a preview of the edits, and
+// only apply them when asked to. anything that modifies files should go through
+// here, so that the default is always a dry run.
+func Rewrite(w io.Writer, edits []Edit, write bool, backup bool) error {
+	fmt.Fprint(w, SprintPreview(edits))
+	if !write {
+		fmt.Fprintf(w, "%d edit(s), dry run: pass --write to apply\n", len(edits))
+		return nil
+	}
+	if err := ApplyEdits(edits, backup); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d edit(s) written\n", len(edits))
+	return nil
+}
+
+// the edits renaming a tag in the headers of the given files, on lines starting
+// with the marker, or TAG_MARKER when it's empty.
+func RenameTag(files []string, old string, new string, marker string) (edits []Edit, err error) {
+	marker = cmp.Or(marker, TAG_MARKER)
+	for _, f := range files {
+		dat, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		s := string(dat)
+		header := ParseHeader(&s)
+		for i, line := range strings.Split(header, "\n") {
+			switch line {
+			case marker + old:
+				edits = append(edits, Edit{f, i + 1, line, marker + new})
+			case marker + old + PRIMARY_MARKER:
+				edits = append(edits, Edit{f, i + 1, line, marker + new + PRIMARY_MARKER})
+			}
+		}
+	}
+	return edits, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// copies the mock files into a temp dir, so they can be safely written.
+func copyMock(t *testing.T) []string {
+	dir := t.TempDir()
+	files, _ := filepath.Glob(TEST_PATTERN)
+	copies := []string{}
+	for _, f := range files {
+		dat, err := os.ReadFile(f)
+		assert.NoError(t, err)
+		c := filepath.Join(dir, filepath.Base(f))
+		assert.NoError(t, os.WriteFile(c, dat, 0644))
+		copies = append(copies, c)
+	}
+	return copies
+}
+
+func TestRenameDryRun(t *testing.T) {
+	files := copyMock(t)
+	edits, err := RenameTag(files, "foo", "fu", "")
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, Rewrite(&buf, edits, false, true))
+	expected := files[0] + ":4\n" +
+		"- + foo\n" +
+		"+ + fu\n" +
+		"1 edit(s), dry run: pass --write to apply\n"
+	assert.Equal(t, expected, buf.String())
+
+	dat, _ := os.ReadFile(files[0])
+	assert.Equal(t, "# 01.foo.md\n: 2024.09.25\n+ sot\n+ foo\n\nFoo bar.\n", string(dat))
+}
+
+func TestRenameWrite(t *testing.T) {
+	files := copyMock(t)
+	edits, err := RenameTag(files, "sot", "soot", "")
+	assert.NoError(t, err)
+	assert.Len(t, edits, 3)
+
+	var buf bytes.Buffer
+	assert.NoError(t, Rewrite(&buf, edits, true, false))
+	dat, _ := os.ReadFile(files[0])
+	assert.Equal(t, "# 01.foo.md\n: 2024.09.25\n+ soot\n+ foo\n\nFoo bar.\n", string(dat))
+	assert.NoFileExists(t, files[0]+BACKUP_SUFFIX)
+
+	// the body is left alone, even where it mentions the tag:
+	edits, _ = RenameTag(files, "sot", "soot", "")
+	assert.Empty(t, edits)
+}
+
+func TestRenamePrimary(t *testing.T) {
+	files := copyMock(t)
+	os.WriteFile(files[0], []byte("# 01.foo.md\n: 2024.09.25\n+ sot!\n+ foo\n\nFoo bar.\n"), 0644)
+
+	edits, err := RenameTag(files[:1], "sot", "soot", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []Edit{{files[0], 3, "+ sot!", "+ soot!"}}, edits)
+}
+
+func TestRenameBackup(t *testing.T) {
+	files := copyMock(t)
+	// two edits to the same file back it up once, as it was before either:
+	os.WriteFile(files[0], []byte("# 01.foo.md\n: 2024.09.25\n+ ml\n+ ml\n\nFoo bar.\n"), 0644)
+
+	out, _ := runMain(t, "--glob", files[0], "--rename", "ml=machine-learning", "--apply")
+	assert.Equal(t, files[0]+":3\n- + ml\n+ + machine-learning\n"+
+		files[0]+":4\n- + ml\n+ + machine-learning\n2 edit(s) written\n", out)
+
+	dat, _ := os.ReadFile(files[0])
+	assert.Equal(t, "# 01.foo.md\n: 2024.09.25\n+ machine-learning\n+ machine-learning\n\nFoo bar.\n", string(dat))
+	backup, err := os.ReadFile(files[0] + BACKUP_SUFFIX)
+	assert.NoError(t, err)
+	assert.Equal(t, "# 01.foo.md\n: 2024.09.25\n+ ml\n+ ml\n\nFoo bar.\n", string(backup))
+}